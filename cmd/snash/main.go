@@ -34,6 +34,31 @@ import (
 // 1.10.6: Add global variable writing, exporting
 // 1.10.7: Fix string escape sequence highlighting
 // 1.11.7: Add an RC file, update help message
+// 1.12.7: Variable expansion
+// 1.13.7: Add pipelines, 'set' keyword with the pipefail option
+// 1.14.7: Add output and input redirections
+// 1.15.7: Add blocks and if statements
+// 1.16.7: Add while and for loops, break and continue, variable scopes
+// 1.17.7: Add functions with positional arguments and return
+// 1.18.7: Add aliases
+// 1.19.7: Add command substitution
+// 1.20.7: Add background jobs and job control
+// 1.21.7: Forward Ctrl+C to the foreground job and drop the input on Ctrl+C
+// 1.22.7: Add tab completion
+// 1.23.7: Add programmable completion with 'complete'
+// 1.24.7: Add multi-line input to the prompt
+// 1.25.7: Add incremental history search
+// 1.26.7: Filter the history by the typed prefix
+// 1.27.7: Save the history as JSON lines, add the history builtin
+// 1.28.7: Add autosuggestions from the history
+// 1.29.7: Add Emacs line editing keys, a kill ring and undo
+// 1.30.7: Add the vi editing mode
+// 1.31.7: Add the bind builtin
+// 1.32.7: Support UTF-8 in the lexer, the key input and the prompt
+// 1.33.7: Use the display width of characters when rendering the prompt
+// 1.34.7: Add filename globbing with the nullglob and failglob options
+// 1.35.7: Add brace expansion and sequences
+// 1.36.7: Add tilde expansion for all words and assignments
 
 var showVersion = flag.Bool("version", false, "Show the version")
 
@@ -51,7 +76,7 @@ func execScript(path string) int {
 
 	err = evaluator.Eval(e, string(data), path)
 	if err != nil {
-		highlighter.PrintError(err.Error())
+		highlighter.PrintError("%v", err)
 
 		os.Exit(1)
 	}
@@ -1,3 +1,5 @@
 module github.com/LordOfTrident/snash
 
 go 1.18
+
+require golang.org/x/sys v0.20.0
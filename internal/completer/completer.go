@@ -0,0 +1,285 @@
+package completer
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/LordOfTrident/snash/internal/token"
+	"github.com/LordOfTrident/snash/internal/lexer"
+	"github.com/LordOfTrident/snash/internal/env"
+	"github.com/LordOfTrident/snash/internal/evaluator"
+)
+
+type Completer struct {
+	env *env.Env
+}
+
+func New(env *env.Env) *Completer {
+	return &Completer{env: env}
+}
+
+func isWordEnd(ch byte) bool {
+	switch ch {
+	case ' ', '\t', '\n', ';', '|', '&', '>', '<', '(': return true
+
+	default: return false
+	}
+}
+
+func isQuote(ch byte) bool {
+	return ch == '\'' || ch == '"' || ch == '`'
+}
+
+// Finds the start of the word which ends at the cursor, quoted characters do not end it
+func wordStart(line string, cursor int) int {
+	start, quote := 0, byte(0)
+	for i := 0; i < cursor; i ++ {
+		switch {
+		case quote != 0:
+			// Only " and ` strings have escape sequences
+			if line[i] == '\\' && quote != '\'' {
+				i ++
+			} else if line[i] == quote {
+				quote = 0
+			}
+
+		case isQuote(line[i]):   quote = line[i]
+		case isWordEnd(line[i]): start = i + 1
+		}
+	}
+
+	return start
+}
+
+// Returns the words of the command left of the index, there are none if a word starting at the
+// index would be parsed as a command
+func cmdWords(line string, start int) (words []string) {
+	toks, _ := lexer.New(line[:start], "stdin").Lex()
+
+	// Ignore the end of file token
+	if len(toks) > 0 && toks[len(toks) - 1].Type == token.EOF {
+		toks = toks[:len(toks) - 1]
+	}
+
+	// The command starts after the last token which expects a statement
+	i := len(toks)
+	for i > 0 && !toks[i - 1].ExpectsStatement() {
+		i --
+	}
+
+	for _, tok := range toks[i:] {
+		if tok.IsArg() {
+			words = append(words, tok.Data)
+		}
+	}
+
+	return
+}
+
+func (c *Completer) Complete(line string, cursor int) (candidates []string, start int) {
+	start = wordStart(line, cursor)
+	word := line[start:cursor]
+
+	// Variables
+	if i := strings.LastIndex(word, "$"); i != -1 {
+		name  := strings.TrimPrefix(word[i + 1:], "{")
+		start += len(word) - len(name)
+
+		candidates = c.completeVars(name)
+
+		// Close the braces of '${NAME}'
+		if len(name) < len(word[i + 1:]) {
+			for j := range candidates {
+				candidates[j] += "}"
+			}
+		}
+
+		return candidates, start
+	}
+
+	words := cmdWords(line, start)
+	if len(words) == 0 {
+		if !strings.Contains(word, "/") {
+			return c.completeCmds(word), start
+		}
+	} else if spec, ok := c.env.Completions[words[0]]; ok {
+		return c.completeSpec(spec, words, word), start
+	}
+
+	return completePaths(word), start
+}
+
+func finish(candidates []string) []string {
+	sort.Strings(candidates)
+
+	// Remove duplicates
+	unique := []string{}
+	for i, candidate := range candidates {
+		if i == 0 || candidate != candidates[i - 1] {
+			unique = append(unique, candidate)
+		}
+	}
+
+	return unique
+}
+
+func (c *Completer) completeSpec(spec env.CompletionSpec, words []string,
+                                 prefix string) (candidates []string) {
+	list := spec.Words
+	if spec.Func != "" {
+		// The function gets the words of the command and the word being completed as arguments,
+		// and outputs one candidate per line
+		out, err := evaluator.CallCaptured(c.env, spec.Func, append(words, prefix))
+		if err != nil {
+			return nil
+		}
+
+		list = strings.Split(out, "\n")
+	}
+
+	for _, candidate := range list {
+		if len(candidate) > 0 && strings.HasPrefix(candidate, prefix) {
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	return finish(candidates)
+}
+
+func (c *Completer) completeVars(prefix string) (candidates []string) {
+	for _, scope := range c.env.Scopes {
+		for name := range scope.SymTable {
+			if strings.HasPrefix(name, prefix) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	return finish(candidates)
+}
+
+func (c *Completer) completeCmds(prefix string) (candidates []string) {
+	for _, keyword := range lexer.Keywords() {
+		if strings.HasPrefix(keyword, prefix) {
+			candidates = append(candidates, keyword)
+		}
+	}
+
+	for name := range c.env.Aliases {
+		if strings.HasPrefix(name, prefix) {
+			candidates = append(candidates, name)
+		}
+	}
+
+	for _, scope := range c.env.Scopes {
+		for name := range scope.Funcs {
+			if strings.HasPrefix(name, prefix) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	// Executables on the path
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Name(), prefix) {
+				continue
+			}
+
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+
+			if !info.IsDir() && info.Mode() & 0111 != 0 {
+				candidates = append(candidates, entry.Name())
+			}
+		}
+	}
+
+	return finish(candidates)
+}
+
+// Characters which mean something in a word
+const special = " \t\n;|&<>()'\"`$#={}*?[~"
+
+// Quotes a path with special characters, so it is inserted as it is. A trailing slash stays out of
+// the quotes to show the path is a directory
+func escape(path string) string {
+	isDir := strings.HasSuffix(path, "/")
+	path   = strings.TrimSuffix(path, "/")
+
+	if strings.ContainsAny(path, special) {
+		// Apostrophes can not be escaped in an apostrophe string, so they are put in quotes
+		path = "'" + strings.Replace(path, "'", `'"'"'`, -1) + "'"
+	}
+
+	if isDir {
+		path += "/"
+	}
+
+	return path
+}
+
+// Removes the quotes of a word, the word might end inside of them
+func unescape(word string) (ret string) {
+	quote := byte(0)
+	for i := 0; i < len(word); i ++ {
+		switch {
+		case quote == 0 && isQuote(word[i]): quote = word[i]
+		case word[i] == quote:               quote = 0
+
+		case word[i] == '\\' && quote != 0 && quote != '\'' && i + 1 < len(word):
+			i ++
+			ret += word[i:i + 1]
+
+		default: ret += word[i:i + 1]
+		}
+	}
+
+	return
+}
+
+// Completes file paths relative to the current directory, directories end with a '/'
+func completePaths(word string) (candidates []string) {
+	word = unescape(word)
+
+	dir, prefix := filepath.Split(word)
+
+	path := dir
+	if path == "" {
+		path = "."
+	} else if strings.HasPrefix(path, "~/") {
+		path = filepath.Join(os.Getenv("HOME"), path[2:])
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		// Hidden files only if asked for
+		if !strings.HasPrefix(name, prefix) || (name[0] == '.' && !strings.HasPrefix(prefix, ".")) {
+			continue
+		}
+
+		// Follow symlinks to see if they point to directories
+		if info, err := os.Stat(filepath.Join(path, name)); err == nil && info.IsDir() {
+			name += "/"
+		}
+
+		candidates = append(candidates, escape(dir + name))
+	}
+
+	return finish(candidates)
+}
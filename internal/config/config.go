@@ -12,7 +12,7 @@ const (
 	AppName = "snash"
 
 	VersionMajor = 1
-	VersionMinor = 11
+	VersionMinor = 36
 	VersionPatch = 7
 
 	GithubLink = "https://github.com/LordOfTrident/snash"
@@ -3,13 +3,27 @@ package env
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"strconv"
 
+	"github.com/LordOfTrident/snash/pkg/term"
+	"github.com/LordOfTrident/snash/pkg/prompt"
+
 	"github.com/LordOfTrident/snash/internal/symtable"
+	"github.com/LordOfTrident/snash/internal/jobs"
+	"github.com/LordOfTrident/snash/internal/history"
+	"github.com/LordOfTrident/snash/internal/node"
 	"github.com/LordOfTrident/snash/internal/utils"
 )
 
+// Completion of a command's arguments, either from a list of words or from the output of a
+// function
+type CompletionSpec struct {
+	Words []string
+	Func  string
+}
+
 // TODO: Add variables to detect the mode of the shell (interactive etc...)
 
 type Env struct {
@@ -17,14 +31,49 @@ type Env struct {
 
 	Scopes []symtable.Scope
 
+	// Streams used by commands and builtins
+	Stdin, Stdout, Stderr *os.File
+
+	Aliases map[string]string
+
+	expanding map[string]bool // Aliases which are currently being expanded
+
+	Completions map[string]CompletionSpec
+
+	Bindings map[term.Key]prompt.Binding // Keys bound to editing actions or commands
+
+	Jobs *jobs.Table // Shared by all forks
+	Job  *jobs.Job   // The job which is being evaluated, nil in the foreground of the shell
+
+	History *history.History // Shared by all forks
+
+	// Working directory, forks have their own so they can not move the shell. Only the shell
+	// itself changes the directory of the process
+	Dir    string
+	forked bool
+
 	Flags struct {
 		ForcedExit bool
 		Echo       bool
+		Pipefail   bool
+		Vi         bool // Vi editing mode of the prompt
+		NullGlob   bool // Globs which match nothing are removed
+		FailGlob   bool // Globs which match nothing are an error
 	}
 }
 
 func New() *Env {
-	env := &Env{}
+	env := &Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+
+	env.Aliases     = make(map[string]string)
+	env.expanding   = make(map[string]bool)
+	env.Completions = make(map[string]CompletionSpec)
+	env.Bindings    = make(map[term.Key]prompt.Binding)
+
+	env.Jobs    = jobs.NewTable()
+	env.History = history.New()
+
+	env.Dir, _ = os.Getwd()
 
 	// Global scope
 	env.PushScope()
@@ -39,12 +88,65 @@ func New() *Env {
 	// Defaults
 	env.Scopes[0].Create("PROMPT",       "$ ",      false)
 	env.Scopes[0].Create("PROMPT_ERROR", "[\\ex] $ ", false)
+	env.Scopes[0].Create("PROMPT_CONT",  "> ",      false)
+
+	env.Scopes[0].Create("HISTORY_SIZE", "1000", false)
 
 	env.Scopes[0].Create("USER", os.Getenv("USER"), false)
 
 	return env
 }
 
+// Creates a copy of the environment with its own copy of the scopes and working directory, used
+// for pipeline stages which should not affect each other or the parent
+func (env *Env) Fork() *Env {
+	fork := *env
+	fork.forked = true
+
+	fork.Scopes = make([]symtable.Scope, len(env.Scopes))
+	for i := range env.Scopes {
+		fork.Scopes[i] = env.Scopes[i].Copy()
+	}
+
+	fork.Aliases = make(map[string]string)
+	for name, value := range env.Aliases {
+		fork.Aliases[name] = value
+	}
+
+	fork.Completions = make(map[string]CompletionSpec)
+	for name, spec := range env.Completions {
+		fork.Completions[name] = spec
+	}
+
+	fork.Bindings = make(map[term.Key]prompt.Binding)
+	for key, binding := range env.Bindings {
+		fork.Bindings[key] = binding
+	}
+
+	fork.expanding = make(map[string]bool)
+	for name := range env.expanding {
+		fork.expanding[name] = true
+	}
+
+	return &fork
+}
+
+// Marks an alias as being expanded, returns false if it already is being expanded, which means
+// the expansion would recurse infinitely
+func (env *Env) StartAliasExpansion(name string) bool {
+	if env.expanding[name] {
+		return false
+	}
+
+	env.expanding[name] = true
+
+	return true
+}
+
+func (env *Env) EndAliasExpansion(name string) {
+	delete(env.expanding, name)
+}
+
 func (env *Env) PushScope() {
 	env.Scopes = append(env.Scopes, symtable.NewScope(len(env.Scopes)))
 }
@@ -53,6 +155,146 @@ func (env *Env) PopScope() {
 	env.Scopes = env.Scopes[:len(env.Scopes) - 1]
 }
 
+func (env *Env) CurrentScope() *symtable.Scope {
+	return &env.Scopes[len(env.Scopes) - 1]
+}
+
+// Finds the innermost scope which has the variable, returns nil if there is none
+func (env *Env) FindScope(name string) *symtable.Scope {
+	for i := len(env.Scopes) - 1; i >= 0; i -- {
+		if env.Scopes[i].Exists(name) {
+			return &env.Scopes[i]
+		}
+	}
+
+	return nil
+}
+
+// Looks up a variable, starting from the innermost scope
+func (env *Env) GetVar(name string) (string, bool) {
+	// Special variables
+	switch name {
+	case "?": return strconv.Itoa(env.Ex), true
+	}
+
+	// Positional arguments are only looked up in the innermost function call scope
+	if isPositional(name) {
+		scope := env.FindScope("#")
+		if scope == nil || !scope.Exists(name) {
+			return "", false
+		}
+
+		return scope.Get(name), true
+	}
+
+	if scope := env.FindScope(name); scope != nil {
+		return scope.Get(name), true
+	}
+
+	return "", false
+}
+
+func isPositional(name string) bool {
+	if name == "@" {
+		return true
+	}
+
+	_, err := strconv.Atoi(name)
+
+	return err == nil
+}
+
+// Returns the arguments of the innermost function call
+func (env *Env) Args() (args []string) {
+	scope := env.FindScope("#")
+	if scope == nil {
+		return
+	}
+
+	count, _ := strconv.Atoi(scope.Get("#"))
+	for i := 1; i <= count; i ++ {
+		args = append(args, scope.Get(strconv.Itoa(i)))
+	}
+
+	return
+}
+
+// Creates the positional argument variables in the current scope
+func (env *Env) SetArgs(args []string) {
+	scope := env.CurrentScope()
+
+	for i, arg := range args {
+		scope.Create(strconv.Itoa(i + 1), arg, false)
+	}
+
+	scope.Create("#", strconv.Itoa(len(args)),   false)
+	scope.Create("@", strings.Join(args, " "), false)
+}
+
+// Finds a function, starting from the innermost scope
+func (env *Env) GetFunc(name string) (*node.Block, bool) {
+	for i := len(env.Scopes) - 1; i >= 0; i -- {
+		if env.Scopes[i].FuncExists(name) {
+			return env.Scopes[i].GetFunc(name).Body, true
+		}
+	}
+
+	return nil, false
+}
+
+// Generates the environment for child processes out of the exported variables, inner scopes
+// override the outer ones
+func (env *Env) Environ() (environ []string) {
+	vars := make(map[string]string)
+	for _, scope := range env.Scopes {
+		for name, v := range scope.SymTable {
+			if v.Export {
+				vars[name] = v.Value
+			} else {
+				delete(vars, name)
+			}
+		}
+	}
+
+	for name, value := range vars {
+		environ = append(environ, name + "=" + value)
+	}
+
+	return
+}
+
+// Resolves a path relative to the working directory
+func (env *Env) Path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+
+	return filepath.Join(env.Dir, path)
+}
+
+// Changes the working directory and updates $PWD and $OLDPWD
+func (env *Env) Chdir(path string) error {
+	path = env.Path(path)
+	if info, err := os.Stat(path); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("Not a directory")
+	}
+
+	if !env.forked {
+		if err := os.Chdir(path); err != nil {
+			return err
+		}
+	}
+
+	env.Scopes[0].Create("OLDPWD", env.Dir, true)
+	env.Scopes[0].Create("PWD",    path,    true)
+
+	env.Dir = path
+
+	return nil
+}
+
 func (env *Env) Update() (err error) {
 	// Update env vars
 	if data, err := os.ReadFile("/etc/hostname"); err == nil {
@@ -64,11 +306,7 @@ func (env *Env) Update() (err error) {
 		                 utils.Quote("/etc/hostname"), utils.Quote("$HOSTNAME"))
 	}
 
-	if path, err := os.Getwd(); err == nil {
-		env.Scopes[0].Create("PWD", path, true)
-	} else {
-		err = fmt.Errorf("Failed to set %v", utils.Quote("$PWD"))
-	}
+	env.Scopes[0].Create("PWD", env.Dir, true)
 
 	if path, err := os.UserHomeDir(); err == nil {
 		env.Scopes[0].Create("HOME", path, true)
@@ -88,6 +326,7 @@ func (env *Env) GenPrompt(prompt string) string {
 	                                         env.Scopes[0].Get("HOME"), "~", -1)
 	promptSpecials["\\u"]  = env.Scopes[0].Get("USER")
 	promptSpecials["\\h"]  = env.Scopes[0].Get("HOSTNAME")
+	promptSpecials["\\m"]  = "\x03" // Replaced with the editing mode by the prompt
 
 	// Apply them
 	for k, v := range promptSpecials {
@@ -8,9 +8,16 @@ import (
 	"github.com/LordOfTrident/snash/internal/node"
 )
 
+type Kind int
+const (
+	Other Kind = iota
+	Incomplete // The source ended early, more lines can complete it
+)
+
 type Error struct {
 	Where token.Where
 	Msg   string
+	Kind  Kind
 }
 
 func (err Error) Error() string {
@@ -21,6 +28,13 @@ func New(where token.Where, format string, args... interface{}) error {
 	return Error{Where: where, Msg: fmt.Sprintf(format, args...)}
 }
 
+// Did the source end early?
+func IsIncomplete(err error) bool {
+	e, ok := err.(Error)
+
+	return ok && e.Kind == Incomplete
+}
+
 func UnexpectedToken(tok *token.Token) error {
 	return New(tok.Where, "Unexpected %v", tok)
 }
@@ -30,6 +44,14 @@ func ExpectedToken(tok *token.Token, expected token.Type) error {
 	           utils.Quote(expected.String()), tok)
 }
 
+func InvalidFd(tok *token.Token) error {
+	return New(tok.Where, "Invalid file descriptor in %v", utils.Quote(tok.Data))
+}
+
+func InvalidExitcode(tok *token.Token) error {
+	return New(tok.Where, "Invalid exitcode %v", utils.Quote(tok.Data))
+}
+
 func CmdNotFound(cmd string, where token.Where) error {
 	return New(where, "Command %v not found", utils.Quote(cmd))
 }
@@ -38,10 +60,27 @@ func FileNotFound(path string, where token.Where) error {
 	return New(where, "File/directory %v not found", utils.Quote(path))
 }
 
+func NoMatches(pattern string, where token.Where) error {
+	return New(where, "No matches found for %v", utils.Quote(pattern))
+}
+
 func VarNotFound(name string, where token.Where) error {
 	return New(where, "Variable %v not found", utils.Quote(name))
 }
 
+func AliasNotFound(name string, where token.Where) error {
+	return New(where, "Alias %v not found", utils.Quote(name))
+}
+
+func BlockNotClosed(where token.Where) error {
+	return Error{Where: where, Msg: "Block not closed", Kind: Incomplete}
+}
+
+// The source ended after an operator which expects more
+func UnexpectedEOF(tok *token.Token) error {
+	return Error{Where: tok.Where, Msg: fmt.Sprintf("Unexpected %v", tok), Kind: Incomplete}
+}
+
 func UnexpectedNode(node node.Node) error {
 	return New(node.NodeToken().Where, "Unexpected %v", node.NodeToken())
 }
@@ -0,0 +1,259 @@
+package evaluator
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/LordOfTrident/snash/internal/token"
+	"github.com/LordOfTrident/snash/internal/node"
+)
+
+// Brace expansion makes multiple words out of one, '{a,b}' expands to each of the alternatives
+// and '{1..10..2}' to a sequence of integers or letters. Only the unquoted braces are expanded,
+// before anything else, so the alternatives can have variables and globs in them
+
+// A piece of a word, either an unquoted character or a part which is kept as it is. Characters
+// are kept whole, so 'café{1,2}' expands to 'café1 café2'
+type braceItem struct {
+	char  string // Empty if the item is a part
+	part  token.Part
+	subst node.Statements
+}
+
+func (item braceItem) is(char byte) bool {
+	return len(item.char) == 1 && item.char[0] == char
+}
+
+func braceItems(word node.Word) (items []braceItem) {
+	substs := word.Substs
+	for _, part := range word.Token.Parts {
+		switch {
+		case part.Type == token.PartText && !part.Quoted:
+			for i := 0; i < len(part.Data); {
+				_, size := utf8.DecodeRuneInString(part.Data[i:])
+
+				items = append(items, braceItem{char: part.Data[i:i + size]})
+				i    += size
+			}
+
+		case part.Type == token.PartSubst:
+			items  = append(items, braceItem{part: part, subst: substs[0]})
+			substs = substs[1:]
+
+		default: items = append(items, braceItem{part: part})
+		}
+	}
+
+	return
+}
+
+// Makes a word out of the items, the unquoted characters are joined into text parts
+func braceWord(tok token.Token, items []braceItem) (word node.Word) {
+	tok.Parts = nil
+	for i, item := range items {
+		if item.char == "" {
+			tok.Parts = append(tok.Parts, item.part)
+			if item.part.Type == token.PartSubst {
+				word.Substs = append(word.Substs, item.subst)
+			}
+		} else if i > 0 && items[i - 1].char != "" {
+			tok.Parts[len(tok.Parts) - 1].Data += item.char
+		} else {
+			tok.Parts = append(tok.Parts, token.Part{Type: token.PartText,
+			                                         Data: item.char, Where: tok.Where})
+		}
+	}
+
+	// A word which expanded to nothing is still an empty word
+	if len(tok.Parts) == 0 {
+		tok.Parts = []token.Part{{Type: token.PartText, Where: tok.Where}}
+	}
+
+	word.Token = tok
+
+	return
+}
+
+func expandBraces(word node.Word) []node.Word {
+	hasBrace := false
+	for _, part := range word.Token.Parts {
+		if part.Type == token.PartText && !part.Quoted && strings.Contains(part.Data, "{") {
+			hasBrace = true
+
+			break
+		}
+	}
+
+	if !hasBrace {
+		return []node.Word{word}
+	}
+
+	var words []node.Word
+	for _, items := range expandBraceItems(braceItems(word)) {
+		words = append(words, braceWord(word.Token, items))
+	}
+
+	return words
+}
+
+func expandBraceItems(items []braceItem) [][]braceItem {
+	// Find the first brace group which expands, braces without alternatives are kept
+	for start := range items {
+		if !items[start].is('{') {
+			continue
+		}
+
+		end, alts := braceGroup(items, start)
+		if len(alts) == 0 {
+			continue
+		}
+
+		// The alternatives and the rest of the word might have more groups
+		var expanded [][]braceItem
+		for _, alt := range alts {
+			word := append(append(append([]braceItem{}, items[:start]...), alt...),
+			               items[end + 1:]...)
+
+			expanded = append(expanded, expandBraceItems(word)...)
+		}
+
+		return expanded
+	}
+
+	return [][]braceItem{items}
+}
+
+// Finds the closing brace of the group and its alternatives, there are no alternatives if the
+// group is not closed or does not expand
+func braceGroup(items []braceItem, start int) (end int, alts [][]braceItem) {
+	depth   := 0
+	altFrom := start + 1
+	for i := start; i < len(items); i ++ {
+		switch {
+		case items[i].is('{'): depth ++
+		case items[i].is('}'):
+			if depth --; depth > 0 {
+				continue
+			}
+
+			if len(alts) == 0 {
+				return i, braceSequence(items[start + 1:i])
+			}
+
+			return i, append(alts, items[altFrom:i])
+
+		case items[i].is(',') && depth == 1:
+			alts    = append(alts, items[altFrom:i])
+			altFrom = i + 1
+		}
+	}
+
+	return -1, nil
+}
+
+// Expands a sequence like '1..10', '01..20' or 'a..z..2', nil if the text is not a sequence
+func braceSequence(items []braceItem) (alts [][]braceItem) {
+	text := ""
+	for _, item := range items {
+		if item.char == "" {
+			return nil
+		}
+
+		text += item.char
+	}
+
+	bounds := strings.Split(text, "..")
+	if len(bounds) != 2 && len(bounds) != 3 {
+		return nil
+	}
+
+	step := 1
+	if len(bounds) == 3 {
+		var err error
+		if step, err = strconv.Atoi(bounds[2]); err != nil {
+			return nil
+		} else if step < 0 {
+			step = -step
+		} else if step == 0 {
+			step = 1
+		}
+	}
+
+	var seq []string
+	if from, to, ok := seqLetters(bounds[0], bounds[1]); ok {
+		for _, i := range seqRange(int(from), int(to), step) {
+			seq = append(seq, string(rune(i)))
+		}
+	} else {
+		from, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil
+		}
+
+		to, err := strconv.Atoi(bounds[1])
+		if err != nil {
+			return nil
+		}
+
+		// A leading zero pads all the integers to the same width
+		width := 0
+		if isZeroPadded(bounds[0]) || isZeroPadded(bounds[1]) {
+			width = len(bounds[0])
+			if len(bounds[1]) > width {
+				width = len(bounds[1])
+			}
+		}
+
+		for _, i := range seqRange(from, to, step) {
+			seq = append(seq, fmt.Sprintf("%0*d", width, i))
+		}
+	}
+
+	for _, str := range seq {
+		var alt []braceItem
+		for i := 0; i < len(str); i ++ {
+			alt = append(alt, braceItem{char: str[i:i + 1]})
+		}
+
+		alts = append(alts, alt)
+	}
+
+	return
+}
+
+// Returns the letters if both bounds are single letters
+func seqLetters(from, to string) (byte, byte, bool) {
+	isLetter := func(str string) bool {
+		return len(str) == 1 && unicode.IsLetter(rune(str[0])) && str[0] < utf8.RuneSelf
+	}
+
+	if !isLetter(from) || !isLetter(to) {
+		return 0, 0, false
+	}
+
+	return from[0], to[0], true
+}
+
+func isZeroPadded(str string) bool {
+	str = strings.TrimPrefix(str, "-")
+
+	return len(str) > 1 && str[0] == '0'
+}
+
+// Integers from one to the other, which can be lower
+func seqRange(from, to, step int) (seq []int) {
+	if from <= to {
+		for i := from; i <= to; i += step {
+			seq = append(seq, i)
+		}
+	} else {
+		for i := from; i >= to; i -= step {
+			seq = append(seq, i)
+		}
+	}
+
+	return
+}
@@ -4,18 +4,27 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
 	"unicode"
 
 	"github.com/LordOfTrident/snash/pkg/term"
+	"github.com/LordOfTrident/snash/pkg/prompt"
 
 	"github.com/LordOfTrident/snash/internal/utils"
 	"github.com/LordOfTrident/snash/internal/config"
 	"github.com/LordOfTrident/snash/internal/errors"
 	"github.com/LordOfTrident/snash/internal/token"
 	"github.com/LordOfTrident/snash/internal/node"
+	"github.com/LordOfTrident/snash/internal/lexer"
 	"github.com/LordOfTrident/snash/internal/parser"
 	"github.com/LordOfTrident/snash/internal/env"
+	"github.com/LordOfTrident/snash/internal/jobs"
+	"github.com/LordOfTrident/snash/internal/history"
 )
 
 func Eval(env *env.Env, source, path string) error {
@@ -36,34 +45,111 @@ func Eval(env *env.Env, source, path string) error {
 	return evalStatements(env, program)
 }
 
+// Signals like break and continue are passed up as errors until something handles them
+
+type signal struct {
+	Token token.Token
+	Ex    int
+}
+
+func (s signal) Error() string {
+	outside := "a loop"
+	if s.Token.Type == token.Return {
+		outside = "a function"
+	}
+
+	return errors.New(s.Token.Where, "Unexpected %v outside of %v",
+	                  utils.Quote(s.Token.Data), outside).Error()
+}
+
+func isSignal(err error, type_ token.Type) bool {
+	s, ok := err.(signal)
+
+	return ok && s.Token.Type == type_
+}
+
 func evalStatements(env *env.Env, statements node.Statements) error {
 	for _, s := range statements.List {
 		if _, err := evalStatement(env, s); err != nil {
 			return err
 		}
+
+		// Stop evaluating if the shell is exiting or Ctrl+C was pressed
+		if env.Flags.ForcedExit {
+			break
+		} else if interrupted(env) {
+			env.Ex = exInterrupted
+
+			break
+		}
 	}
 
 	return nil
 }
 
+const exInterrupted = 128 + int(syscall.SIGINT)
+
+// Was the evaluation interrupted by Ctrl+C? Jobs in the background keep running
+func interrupted(env *env.Env) bool {
+	return term.Interrupted() && (env.Job == nil || env.Jobs.InForeground(env.Job))
+}
+
 func evalStatement(env *env.Env, s node.Statement) (ex int, err error) {
+	// Redirect the streams for the time the statement is evaluated
+	if rs, ok := s.(node.RedirectedStatement); ok && len(rs.NodeRedirects()) > 0 {
+		restore, err := redirect(env, rs.NodeRedirects())
+		if err != nil {
+			env.Ex = 1
+
+			return 1, err
+		}
+
+		defer restore()
+	}
+
 	switch s := s.(type) {
 	case *node.LetStatement:    err = evalLet(env, s)
 	case *node.AssignStatement: err = evalAssign(env, s)
 	case *node.ExportStatement: err = evalExport(env, s)
+	case *node.SetStatement:    err = evalSet(env, s)
 
 	case *node.CmdStatement:  ex, err = evalCmd(env, s)
 	case *node.CdStatement:   err     = evalCd(env, s)
 	case *node.ExitStatement: ex      = evalExit(env, s)
+	case *node.EchoStatement: err     = evalEcho(env, s)
 	case *node.HelpStatement:           evalHelp(env, s)
-	case *node.EchoStatement:           evalEcho(env, s)
+
+	case *node.Block:       ex, err = evalBlock(env, s)
+	case *node.IfStatement: ex, err = evalIf(env, s)
+
+	case *node.WhileStatement:    ex, err = evalWhile(env, s)
+	case *node.ForStatement:      ex, err = evalFor(env, s)
+	case *node.BreakStatement:    err     = signal{Token: s.Token}
+	case *node.ContinueStatement: err     = signal{Token: s.Token}
+
+	case *node.FnStatement:     evalFn(env, s)
+	case *node.ReturnStatement: err = evalReturn(env, s)
+
+	case *node.AliasStatement:   err = evalAlias(env, s)
+	case *node.UnaliasStatement: err = evalUnalias(env, s)
+
+	case *node.CompleteStatement: err = evalComplete(env, s)
+	case *node.HistoryStatement:  err = evalHistory(env, s)
+	case *node.BindStatement:     err = evalBind(env, s)
 
 	case *node.BinOpStatement: ex, err = evalBinOp(env, s)
+	case *node.PipeStatement:  ex, err = evalPipe(env, s)
+
+	case *node.BackgroundStatement: evalBackground(env, s)
+	case *node.JobStatement:        ex, err = evalJob(env, s)
 
 	default: err = errors.UnexpectedNode(s)
 	}
 
-	if err != nil && ex == 0 {
+	// Signals carry their own exitcode
+	if s, ok := err.(signal); ok {
+		ex = s.Ex
+	} else if err != nil && ex == 0 {
 		ex = 1
 	}
 
@@ -72,40 +158,689 @@ func evalStatement(env *env.Env, s node.Statement) (ex int, err error) {
 	return
 }
 
-func evalLet(env *env.Env, let *node.LetStatement) error {
-	for i, ch := range let.Name {
+func checkVarName(name string, where token.Where) error {
+	for i, ch := range name {
 		if !unicode.IsLetter(ch) && !unicode.IsDigit(ch) && ch != '_' {
-			return errors.New(let.NodeToken().Where,
-			                     "Unexpected character %v at %v in variable identifier",
-			                     utils.Quote(string(ch)), i)
+			return errors.New(where, "Unexpected character %v at %v in variable identifier",
+			                  utils.Quote(string(ch)), i)
 		}
 	}
 
-	env.Scopes[0].Create(let.Name, let.Value, false)
+	return nil
+}
+
+func evalLet(env *env.Env, let *node.LetStatement) error {
+	if err := checkVarName(let.Name, let.NodeToken().Where); err != nil {
+		return err
+	}
+
+	value, err := expandAssign(env, let.Value)
+	if err != nil {
+		return err
+	}
+
+	// Variables are created in the innermost scope which already has them, so a loop does not
+	// hide them, or else in the current scope
+	scope := env.FindScope(let.Name)
+	if scope == nil {
+		scope = env.CurrentScope()
+	}
+
+	scope.Create(let.Name, value, false)
 
 	return nil
 }
 
 func evalAssign(env *env.Env, as *node.AssignStatement) error {
-	if !env.Scopes[0].Exists(as.Name) {
+	scope := env.FindScope(as.Name)
+	if scope == nil {
 		return errors.VarNotFound(as.Name, as.NodeToken().Where)
 	}
 
-	env.Scopes[0].Set(as.Name, as.Value)
+	value, err := expandAssign(env, as.Value)
+	if err != nil {
+		return err
+	}
+
+	scope.Set(as.Name, value)
 
 	return nil
 }
 
 func evalExport(env *env.Env, export *node.ExportStatement) error {
-	if !env.Scopes[0].Exists(export.Name) {
+	scope := env.FindScope(export.Name)
+	if scope == nil {
 		return errors.VarNotFound(export.Name, export.NodeToken().Where)
 	}
 
-	env.Scopes[0].Export(export.Name, true)
+	scope.Export(export.Name, true)
+
+	return nil
+}
+
+func evalBlock(env *env.Env, b *node.Block) (int, error) {
+	if err := evalStatements(env, b.Body); err != nil {
+		return 1, err
+	}
+
+	return env.Ex, nil
+}
+
+func evalIf(env *env.Env, is *node.IfStatement) (int, error) {
+	if _, err := evalStatement(env, is.Cond); err != nil {
+		return 1, err
+	}
+
+	// The body is only evaluated if the condition succeeded
+	if env.Ex == 0 {
+		return evalBlock(env, is.Body)
+	} else if is.Else != nil {
+		return evalStatement(env, is.Else)
+	}
+
+	return 0, nil
+}
+
+func evalWhile(env *env.Env, ws *node.WhileStatement) (ex int, err error) {
+	for !env.Flags.ForcedExit {
+		if interrupted(env) {
+			return exInterrupted, nil
+		}
+
+		if _, err = evalStatement(env, ws.Cond); err != nil {
+			return 1, err
+		}
+
+		// Stop once the condition fails
+		if env.Ex != 0 {
+			break
+		}
+
+		ex, err = evalBlock(env, ws.Body)
+		if isSignal(err, token.Break) {
+			return 0, nil
+		} else if err != nil && !isSignal(err, token.Continue) {
+			return ex, err
+		}
+	}
+
+	return ex, nil
+}
+
+func evalFor(env *env.Env, fs *node.ForStatement) (ex int, err error) {
+	if err := checkVarName(fs.Var, fs.NodeToken().Where); err != nil {
+		return 1, err
+	}
+
+	words, err := expandWords(env, fs.Words)
+	if err != nil {
+		return 1, err
+	}
+
+	// The loop variable lives in its own scope
+	env.PushScope()
+	defer env.PopScope()
+
+	for _, word := range words {
+		if env.Flags.ForcedExit {
+			break
+		} else if interrupted(env) {
+			return exInterrupted, nil
+		}
+
+		env.CurrentScope().Create(fs.Var, word, false)
+
+		ex, err = evalBlock(env, fs.Body)
+		if isSignal(err, token.Break) {
+			return 0, nil
+		} else if err != nil && !isSignal(err, token.Continue) {
+			return ex, err
+		}
+	}
+
+	return ex, nil
+}
+
+func evalFn(env *env.Env, fs *node.FnStatement) {
+	env.CurrentScope().CreateFunc(fs.Name, fs.Body)
+}
+
+func evalReturn(env *env.Env, rs *node.ReturnStatement) error {
+	// Without a requested exitcode, return the latest exitcode
+	if rs.HasEx {
+		return signal{Token: rs.Token, Ex: rs.Ex}
+	}
+
+	return signal{Token: rs.Token, Ex: env.Ex}
+}
+
+func evalCall(env *env.Env, body *node.Block, args []string) (int, error) {
+	// Every call has its own scope with the arguments
+	env.PushScope()
+	defer env.PopScope()
+
+	env.SetArgs(args)
+
+	ex, err := evalBlock(env, body)
+	if s, ok := err.(signal); ok && s.Token.Type == token.Return {
+		return s.Ex, nil
+	}
+
+	return ex, err
+}
+
+func evalAlias(env *env.Env, as *node.AliasStatement) error {
+	// List all the aliases
+	if !as.HasName {
+		var names []string
+		for name := range env.Aliases {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			fmt.Fprintf(env.Stdout, "alias %v = %v\n", name, utils.Quote(env.Aliases[name]))
+		}
+
+		return nil
+	}
+
+	// Show a single alias
+	if !as.HasValue {
+		value, ok := env.Aliases[as.Name]
+		if !ok {
+			return errors.AliasNotFound(as.Name, as.NodeToken().Where)
+		}
+
+		fmt.Fprintf(env.Stdout, "alias %v = %v\n", as.Name, utils.Quote(value))
+
+		return nil
+	}
+
+	value, err := expandWord(env, as.Value)
+	if err != nil {
+		return err
+	}
+
+	env.Aliases[as.Name] = value
+
+	return nil
+}
+
+func evalUnalias(env *env.Env, us *node.UnaliasStatement) error {
+	names, err := expandWords(env, us.Names)
+	if err != nil {
+		return err
+	}
+
+	for i, name := range names {
+		if _, ok := env.Aliases[name]; !ok {
+			return errors.AliasNotFound(name, us.Names[i].NodeToken().Where)
+		}
+
+		delete(env.Aliases, name)
+	}
 
 	return nil
 }
 
+func printCompletion(env *env.Env, name string) {
+	spec := env.Completions[name]
+	if spec.Func != "" {
+		fmt.Fprintf(env.Stdout, "complete %v -f %v\n", name, spec.Func)
+	} else {
+		fmt.Fprintf(env.Stdout, "complete %v -w %v\n", name,
+		            utils.Quote(strings.Join(spec.Words, " ")))
+	}
+}
+
+func evalComplete(env *env.Env, cs *node.CompleteStatement) error {
+	args, err := expandWords(env, cs.Args)
+	if err != nil {
+		return err
+	}
+
+	// List all the completions
+	if len(args) == 0 {
+		var names []string
+		for name := range env.Completions {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			printCompletion(env, name)
+		}
+
+		return nil
+	}
+
+	// Remove completions
+	if args[0] == "-r" {
+		if len(args) == 1 {
+			return errors.New(cs.Args[0].NodeToken().Where, "Expected a command name after %v",
+			                  utils.Quote(args[0]))
+		}
+
+		for i, name := range args[1:] {
+			if _, ok := env.Completions[name]; !ok {
+				return errors.New(cs.Args[i + 1].NodeToken().Where,
+				                  "Completion for %v not found", utils.Quote(name))
+			}
+
+			delete(env.Completions, name)
+		}
+
+		return nil
+	}
+
+	name := args[0]
+
+	// Show a single completion
+	if len(args) == 1 {
+		if _, ok := env.Completions[name]; !ok {
+			return errors.New(cs.Args[0].NodeToken().Where,
+			                  "Completion for %v not found", utils.Quote(name))
+		}
+
+		printCompletion(env, name)
+
+		return nil
+	}
+
+	where := cs.Args[1].NodeToken().Where
+	if len(args) != 3 {
+		return errors.New(where, "Expected %v or %v followed by one argument",
+		                  utils.Quote("-w"), utils.Quote("-f"))
+	}
+
+	spec := env.Completions[name]
+	switch args[1] {
+	case "-w": spec.Words, spec.Func = strings.Fields(args[2]), ""
+	case "-f": spec.Words, spec.Func = nil, args[2]
+
+	default: return errors.New(where, "Unexpected argument %v", utils.Quote(args[1]))
+	}
+
+	env.Completions[name] = spec
+
+	return nil
+}
+
+func printHistoryEntry(env *env.Env, id int, entry history.Entry, verbose bool) {
+	const indent = "                            "
+
+	// Entries from the old history format have no information besides the command
+	when := "-"
+	if entry.Time != 0 {
+		when = time.Unix(entry.Time, 0).Format("2006-01-02 15:04:05")
+	}
+
+	fmt.Fprintf(env.Stdout, "%5v  %-19v  %v\n", id, when,
+	            strings.Replace(entry.Cmd, "\n", "\n" + indent, -1))
+
+	if verbose && entry.Time != 0 {
+		fmt.Fprintf(env.Stdout, "%vexit %v, took %.2fs in %v\n", indent, entry.Ex, entry.Duration,
+		            utils.Quote(entry.Cwd))
+	}
+}
+
+func evalHistory(env *env.Env, hs *node.HistoryStatement) error {
+	args, err := expandWords(env, hs.Args)
+	if err != nil {
+		return err
+	}
+
+	verbose := false
+	found   := make([]int, len(env.History.Entries))
+	for i := range found {
+		found[i] = i
+	}
+
+	for i := 0; i < len(args); i ++ {
+		where := hs.Args[i].NodeToken().Where
+
+		switch args[i] {
+		case "-v": verbose = true
+
+		// Search for the entries containing a string
+		case "-s":
+			if i + 1 >= len(args) {
+				return errors.New(where, "Expected a string after %v", utils.Quote(args[i]))
+			}
+
+			found = env.History.Search(args[i + 1])
+
+			i ++
+
+		// Delete entries
+		case "-d":
+			if i + 1 >= len(args) {
+				return errors.New(where, "Expected an entry number after %v", utils.Quote(args[i]))
+			}
+
+			var ids []int
+			for j, arg := range args[i + 1:] {
+				id, err := strconv.Atoi(arg)
+				if err != nil || id < 1 || id > len(env.History.Entries) {
+					return errors.New(hs.Args[i + 1 + j].NodeToken().Where,
+					                  "History entry %v not found", utils.Quote(arg))
+				}
+
+				ids = append(ids, id)
+			}
+
+			// Delete from the end so the other numbers stay valid
+			sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+			for j, id := range ids {
+				if j > 0 && ids[j - 1] == id {
+					continue
+				}
+
+				if err := env.History.Delete(id - 1); err != nil {
+					return errors.New(where, "Could not delete history entry %v: %v", id, err)
+				}
+			}
+
+			return nil
+
+		default: return errors.New(where, "Unexpected argument %v", utils.Quote(args[i]))
+		}
+	}
+
+	for _, i := range found {
+		printHistoryEntry(env, i + 1, env.History.Entries[i], verbose)
+	}
+
+	return nil
+}
+
+func printBinding(env *env.Env, key term.Key) {
+	binding := env.Bindings[key]
+	if len(binding.Cmd) > 0 {
+		fmt.Fprintf(env.Stdout, "bind %v %v\n", key, utils.Quote(binding.Cmd))
+	} else {
+		fmt.Fprintf(env.Stdout, "bind %v %v\n", key, binding.Action)
+	}
+}
+
+func evalBind(env *env.Env, bs *node.BindStatement) error {
+	args, err := expandWords(env, bs.Args)
+	if err != nil {
+		return err
+	}
+
+	// List all the bindings
+	if len(args) == 0 {
+		var keys []term.Key
+		for key := range env.Bindings {
+			keys = append(keys, key)
+		}
+
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+
+		for _, key := range keys {
+			printBinding(env, key)
+		}
+
+		return nil
+	}
+
+	switch args[0] {
+	// List the actions which can be bound
+	case "-a":
+		for _, action := range prompt.Actions() {
+			fmt.Fprintln(env.Stdout, action)
+		}
+
+		return nil
+
+	// Remove bindings
+	case "-r":
+		if len(args) == 1 {
+			return errors.New(bs.Args[0].NodeToken().Where, "Expected a key after %v",
+			                  utils.Quote(args[0]))
+		}
+
+		for i, name := range args[1:] {
+			key, ok := term.ParseKey(name)
+			if _, bound := env.Bindings[key]; !ok || !bound {
+				return errors.New(bs.Args[i + 1].NodeToken().Where,
+				                  "Binding of %v not found", utils.Quote(name))
+			}
+
+			delete(env.Bindings, key)
+		}
+
+		return nil
+	}
+
+	key, ok := term.ParseKey(args[0])
+	if !ok {
+		return errors.New(bs.Args[0].NodeToken().Where, "Unknown key %v", utils.Quote(args[0]))
+	}
+
+	switch len(args) {
+	// Show a single binding
+	case 1:
+		if _, ok := env.Bindings[key]; !ok {
+			return errors.New(bs.Args[0].NodeToken().Where,
+			                  "Binding of %v not found", utils.Quote(args[0]))
+		}
+
+		printBinding(env, key)
+
+	// Anything which is not an action is a command
+	case 2:
+		if prompt.IsAction(args[1]) {
+			env.Bindings[key] = prompt.Binding{Action: args[1]}
+		} else {
+			env.Bindings[key] = prompt.Binding{Cmd: args[1]}
+		}
+
+	default:
+		return errors.New(bs.Args[2].NodeToken().Where,
+		                  "Unexpected argument %v, the command has to be quoted",
+		                  utils.Quote(args[2]))
+	}
+
+	return nil
+}
+
+// Evaluates an alias call by putting the tokens of the alias in place of the command name
+func evalAliasCall(env *env.Env, cs *node.CmdStatement, name, value string) (int, error) {
+	defer env.EndAliasExpansion(name)
+
+	toks, err := lexer.New(value, "alias " + utils.Quote(name)).Lex()
+	if err != nil {
+		return 1, err
+	}
+
+	// Replace the EOF token with the arguments (unexpanded, so they are only expanded once)
+	toks = toks[:len(toks) - 1]
+	for _, arg := range cs.Args {
+		toks = append(toks, arg.Token)
+	}
+
+	toks = append(toks, token.NewEOF(cs.NodeToken().Where))
+
+	program, err := parser.NewFromTokens(toks).Parse()
+	if err != nil {
+		return 1, err
+	}
+
+	if err := evalStatements(env, program); err != nil {
+		return 1, err
+	}
+
+	return env.Ex, nil
+}
+
+// Shell options that can be changed with 'set'
+func options(env *env.Env) map[string]*bool {
+	return map[string]*bool{
+		"pipefail":        &env.Flags.Pipefail,
+		"vi":              &env.Flags.Vi,
+		"nullglob":        &env.Flags.NullGlob,
+		"failglob":        &env.Flags.FailGlob,
+		"histignoredups":  &env.History.IgnoreDups,
+		"histignorespace": &env.History.IgnoreSpace,
+	}
+}
+
+func evalSet(env *env.Env, set *node.SetStatement) error {
+	args, err := expandWords(env, set.Args)
+	if err != nil {
+		return err
+	}
+
+	opts := options(env)
+
+	// With no arguments, list all the options
+	if len(args) == 0 {
+		var names []string
+		for name := range opts {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		for _, name := range names {
+			state := "off"
+			if *opts[name] {
+				state = "on"
+			}
+
+			fmt.Fprintf(env.Stdout, "%-16v %v\n", name, state)
+		}
+
+		return nil
+	}
+
+	for i := 0; i < len(args); i ++ {
+		where := set.Args[i].NodeToken().Where
+
+		switch args[i] {
+		// '-o' enables an option, '+o' disables it
+		case "-o", "+o":
+			if i + 1 >= len(args) {
+				return errors.New(where, "Expected an option name after %v", utils.Quote(args[i]))
+			}
+
+			opt, ok := opts[args[i + 1]]
+			if !ok {
+				return errors.New(set.Args[i + 1].NodeToken().Where,
+				                  "Unknown option %v", utils.Quote(args[i + 1]))
+			}
+
+			*opt = args[i] == "-o"
+
+			i ++
+
+		default: return errors.New(where, "Unexpected argument %v", utils.Quote(args[i]))
+		}
+	}
+
+	return nil
+}
+
+func evalPipe(env *env.Env, pipe *node.PipeStatement) (int, error) {
+	// Pipelines inside of a job are a part of that job
+	if env.Job != nil {
+		return startPipe(env, pipe, env.Job)()
+	}
+
+	job  := env.Jobs.New(jobText(pipe), true)
+	wait := startPipe(env, pipe, job)
+
+	var err error
+	go func() {
+		var ex int
+		ex, err = wait()
+
+		env.Jobs.Finish(job, ex)
+	}()
+
+	// The error is only known if the pipeline finished
+	if ex, stopped := waitForeground(env, job); stopped {
+		return ex, nil
+	} else {
+		return ex, err
+	}
+}
+
+// Starts all the stages of a pipeline and returns a function which waits for them
+func startPipe(env *env.Env, pipe *node.PipeStatement, job *jobs.Job) func() (int, error) {
+	exs  := make([]int,   len(pipe.Stages))
+	errs := make([]error, len(pipe.Stages))
+
+	var wg sync.WaitGroup
+
+	// Run all the stages at the same time, each with its stdout connected to the stdin of the
+	// next stage
+	stdin := env.Stdin
+	for i, stage := range pipe.Stages {
+		i, stage := i, stage
+
+		fork := env.Fork()
+		fork.Stdin = stdin
+		fork.Job   = job
+
+		if i < len(pipe.Stages) - 1 {
+			r, w, err := os.Pipe()
+			if err != nil {
+				panic(err)
+			}
+
+			fork.Stdout = w
+			stdin       = r
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			exs[i], errs[i] = evalStatement(fork, stage)
+
+			// Close our ends of the pipes so the neighbouring stages get EOF or EPIPE
+			if fork.Stdin != env.Stdin {
+				fork.Stdin.Close()
+			}
+
+			if fork.Stdout != env.Stdout {
+				fork.Stdout.Close()
+			}
+		}()
+	}
+
+	return func() (int, error) {
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				return 1, err
+			}
+		}
+
+		// The exitcode of a pipeline is the exitcode of the last stage, or with pipefail the
+		// exitcode of the last stage that failed
+		ex := exs[len(exs) - 1]
+		if env.Flags.Pipefail {
+			for _, stageEx := range exs {
+				if stageEx != 0 {
+					ex = stageEx
+				}
+			}
+		}
+
+		return ex, nil
+	}
+}
+
 func evalBinOp(env *env.Env, bin *node.BinOpStatement) (int, error) {
 	switch bin.NodeToken().Type {
 	case token.Or:  return evalOrBinOp(env, bin)
@@ -154,55 +889,63 @@ func evalAndBinOp(env *env.Env, bin *node.BinOpStatement) (int, error) {
 }
 
 func evalCmd(env *env.Env, cs *node.CmdStatement) (int, error) {
-	// Echo the command if echo is enabled
-	if env.Flags.Echo {
-		fmt.Printf("%v ", cs.Cmd)
+	// Aliases are expanded first, but only if the command name is written literally
+	if isLiteral(cs.Cmd) {
+		name := cs.Cmd.Token.Data
+		if value, ok := env.Aliases[name]; ok && env.StartAliasExpansion(name) {
+			return evalAliasCall(env, cs, name, value)
+		}
 	}
 
-	// Read the command arguments
-	var args []string
-	for _, str := range cs.Args {
-		// Echo each argument if echo is enabled
-		if env.Flags.Echo {
-			fmt.Printf("\"%v \"", str)
-		}
+	cmd, err := expandWord(env, cs.Cmd)
+	if err != nil {
+		return 1, err
+	}
 
-		args = append(args, str)
+	// Expand the command arguments
+	args, err := expandWords(env, cs.Args)
+	if err != nil {
+		return 1, err
 	}
 
-	// Go to a new line if echo is enabled
+	// Echo the command and each argument if echo is enabled
 	if env.Flags.Echo {
+		fmt.Printf("%v ", cmd)
+
+		for _, arg := range args {
+			fmt.Printf("\"%v \"", arg)
+		}
+
 		fmt.Println()
 	}
 
-	// If the command does not exist, return exitcode 127
-	if _, err := exec.LookPath(cs.Cmd); err != nil {
-		return 127, errors.CmdNotFound(cs.Cmd, cs.NodeToken().Where)
+	// Functions take priority over executables
+	if body, ok := env.GetFunc(cmd); ok {
+		return evalCall(env, body, args)
 	}
 
-	// Redirect streams and execute the command
-	process := exec.Command(cs.Cmd, args...)
-	process.Stderr = os.Stderr
-	process.Stdout = os.Stdout
-	process.Stdin  = os.Stdin
-
-	process.Env = []string{}
-	for i, v := range env.Scopes[0].SymTable {
-		if v.Export {
-			process.Env = append(process.Env, i + "=" + v.Value)
-		}
+	// Paths to executables are relative to the working directory of the shell
+	path := cmd
+	if strings.Contains(cmd, "/") {
+		path = env.Path(cmd)
 	}
 
-	if err := process.Start(); err != nil {
-		panic(err)
+	// If the command does not exist, return exitcode 127
+	if _, err := exec.LookPath(path); err != nil {
+		return 127, errors.CmdNotFound(cmd, cs.NodeToken().Where)
 	}
 
-	err := process.Wait()
-	if exErr, ok := err.(*exec.ExitError); ok {
-		return exErr.ExitCode(), nil
-	}
+	// Redirect streams and execute the command
+	process := exec.Command(path, args...)
+	process.Args[0] = cmd
+	process.Dir    = env.Dir
+	process.Stderr = env.Stderr
+	process.Stdout = env.Stdout
+	process.Stdin  = env.Stdin
 
-	return 0, nil
+	process.Env = env.Environ()
+
+	return runProcess(env, process, jobText(cs)), nil
 }
 
 func evalExit(env *env.Env, ex *node.ExitStatement) int {
@@ -223,28 +966,66 @@ func keywordHighlight(keyword string) string {
 }
 
 func evalHelp(env *env.Env, echo *node.HelpStatement) {
-	fmt.Printf("%v help\nversion %v.%v.%v\n",
-	           config.AppName, config.VersionMajor, config.VersionMinor, config.VersionPatch)
+	fmt.Fprintf(env.Stdout, "%v help\nversion %v.%v.%v\n",
+	            config.AppName, config.VersionMajor, config.VersionMinor, config.VersionPatch)
 
-	fmt.Println("\nSee " + term.AttrUnderline + term.AttrBrightGreen +
-	            config.GithubLink + term.AttrReset)
+	fmt.Fprintln(env.Stdout, "\nSee " + term.AttrUnderline + term.AttrBrightGreen +
+	             config.GithubLink + term.AttrReset)
 
-	fmt.Println("\nBuilt-in commands:")
-	fmt.Printf("  %v           Show this message\n",                 keywordHighlight("help"))
-	fmt.Printf("  %v [str...]  Output a string\n",                   keywordHighlight("echo"))
-	fmt.Printf("  %v [int]     Exit the process with an exitcode\n", keywordHighlight("exit"))
-	fmt.Printf("  %v [path]    Change the current directory\n",      keywordHighlight("cd  "))
+	fmt.Fprintln(env.Stdout, "\nBuilt-in commands:")
+	fmt.Fprintf(env.Stdout, "  %v           Show this message\n",
+	            keywordHighlight("help"))
+	fmt.Fprintf(env.Stdout, "  %v [str...]  Output a string\n",
+	            keywordHighlight("echo"))
+	fmt.Fprintf(env.Stdout, "  %v [int]     Exit the process with an exitcode\n",
+	            keywordHighlight("exit"))
+	fmt.Fprintf(env.Stdout, "  %v [path]    Change the current directory\n",
+	            keywordHighlight("cd  "))
+	fmt.Fprintf(env.Stdout, "  %v [-o opt]   Enable (-o) or disable (+o) an option\n",
+	            keywordHighlight("set"))
+	fmt.Fprintf(env.Stdout, "  %v [n = s]  Define, show or list aliases\n",
+	            keywordHighlight("alias"))
+	fmt.Fprintf(env.Stdout, "  %v <n>    Remove an alias\n",
+	            keywordHighlight("unalias"))
+	fmt.Fprintf(env.Stdout, "  %v [n..] Define, show or list completions\n",
+	            keywordHighlight("complete"))
+	fmt.Fprintf(env.Stdout, "  %v [opts] List, search or delete history entries\n",
+	            keywordHighlight("history"))
+	fmt.Fprintf(env.Stdout, "  %v [k a|c]   Bind a key to an action or a command\n",
+	            keywordHighlight("bind"))
+	fmt.Fprintf(env.Stdout, "  %v           List the jobs\n",
+	            keywordHighlight("jobs"))
+	fmt.Fprintf(env.Stdout, "  %v [%%n]        Continue a job in the foreground\n",
+	            keywordHighlight("fg"))
+	fmt.Fprintf(env.Stdout, "  %v [%%n]        Continue a job in the background\n",
+	            keywordHighlight("bg"))
+	fmt.Fprintf(env.Stdout, "  %v [%%n...]   Wait for jobs to finish\n",
+	            keywordHighlight("wait"))
 }
 
-func evalEcho(env *env.Env, echo *node.EchoStatement) {
-	fmt.Println(echo.Msg)
+func evalEcho(env *env.Env, echo *node.EchoStatement) error {
+	args, err := expandWords(env, echo.Args)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(env.Stdout, strings.Join(args, " "))
+
+	return nil
 }
 
 func evalCd(env *env.Env, cd *node.CdStatement) error {
-	// Replace the '~' with the home directory path and change the directory
-	err := os.Chdir(strings.Replace(cd.Path, "~", os.Getenv("HOME"), -1))
-	if err != nil {
-		return errors.FileNotFound(cd.Path, cd.NodeToken().Where)
+	// Without a path, go to the home directory
+	path, _ := env.GetVar("HOME")
+	if cd.HasPath {
+		var err error
+		if path, err = expandWord(env, cd.Path); err != nil {
+			return err
+		}
+	}
+
+	if err := env.Chdir(path); err != nil {
+		return errors.FileNotFound(path, cd.NodeToken().Where)
 	}
 
 	return nil
@@ -0,0 +1,181 @@
+package evaluator
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/LordOfTrident/snash/internal/utils"
+	"github.com/LordOfTrident/snash/internal/errors"
+	"github.com/LordOfTrident/snash/internal/token"
+	"github.com/LordOfTrident/snash/internal/node"
+	"github.com/LordOfTrident/snash/internal/env"
+)
+
+// Is the word free of any expansions?
+func isLiteral(word node.Word) bool {
+	for _, part := range word.Token.Parts {
+		if part.Type != token.PartText {
+			return false
+		}
+	}
+
+	return true
+}
+
+func expandWord(env *env.Env, word node.Word) (string, error) {
+	str, _, err := expandWordGlob(env, expandTilde(env, word, false))
+
+	return str, err
+}
+
+// Assigned values also expand the tildes after colons, like in 'PATH = ~/bin:~/.local/bin'
+func expandAssign(env *env.Env, word node.Word) (string, error) {
+	str, _, err := expandWordGlob(env, expandTilde(env, word, true))
+
+	return str, err
+}
+
+// Expands the word and also returns it as a glob pattern, in which only the unquoted text can have
+// special characters. The pattern is empty if the word is not a glob
+func expandWordGlob(env *env.Env, word node.Word) (str, pattern string, err error) {
+	// Tokens without parts (like integers) are always literal
+	if len(word.Token.Parts) == 0 {
+		return word.Token.Data, "", nil
+	}
+
+	isGlob := false
+	substs := word.Substs
+	for _, part := range word.Token.Parts {
+		value := part.Data
+
+		switch part.Type {
+		case token.PartText:
+			if !part.Quoted && strings.ContainsAny(value, "*?[") {
+				str     += value
+				pattern += strings.Replace(value, "\\", "\\\\", -1)
+				isGlob   = true
+
+				continue
+			}
+
+		case token.PartVar:
+			var ok bool
+			if value, ok = env.GetVar(part.Data); !ok {
+				return "", "", errors.VarNotFound(part.Data, part.Where)
+			}
+
+		case token.PartSubst:
+			if value, err = evalSubst(env, substs[0]); err != nil {
+				return "", "", err
+			}
+
+			substs = substs[1:]
+
+		default: panic("Unreachable")
+		}
+
+		// Expanded values never have special characters
+		str     += value
+		pattern += escapeGlob(value)
+	}
+
+	if !isGlob {
+		pattern = ""
+	}
+
+	return str, pattern, nil
+}
+
+func expandWords(env *env.Env, words []node.Word) ([]string, error) {
+	var strs []string
+	for _, word := range words {
+		// A word which is just $@ expands to all the arguments as separate words
+		if parts := word.Token.Parts; len(parts) == 1 && parts[0].Type == token.PartVar &&
+		                              parts[0].Data == "@" {
+			strs = append(strs, env.Args()...)
+
+			continue
+		}
+
+		// Braces are expanded first, then the tildes and the globs last
+		for _, word := range expandBraces(word) {
+			str, pattern, err := expandWordGlob(env, expandTilde(env, word, false))
+			if err != nil {
+				return nil, err
+			} else if len(pattern) == 0 {
+				strs = append(strs, str)
+
+				continue
+			}
+
+			// Words which match no paths are kept as they are, unless set otherwise
+			if matches := glob(env.Dir, pattern); len(matches) > 0 {
+				strs = append(strs, matches...)
+			} else if env.Flags.FailGlob {
+				return nil, errors.NoMatches(str, word.Token.Where)
+			} else if !env.Flags.NullGlob {
+				strs = append(strs, str)
+			}
+		}
+	}
+
+	return strs, nil
+}
+
+// Creates a copy of the environment with its output captured, the returned function finishes the
+// capture and returns the output
+func capture(env *env.Env) (fork *env.Env, output func() string) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		panic(err)
+	}
+
+	fork = env.Fork()
+	fork.Stdout = w
+
+	// Read the output while evaluating, so the pipe never gets full
+	out := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		r.Close()
+
+		out <- string(data)
+	}()
+
+	return fork, func() string {
+		w.Close()
+
+		return <-out
+	}
+}
+
+// Evaluates a command substitution and returns its output without the trailing new lines
+func evalSubst(env *env.Env, program node.Statements) (string, error) {
+	// Command substitutions can not change the environment, so they get a copy of it with its own
+	// working directory
+	fork, output := capture(env)
+	err := evalStatements(fork, program)
+
+	return strings.TrimRight(output(), "\n"), err
+}
+
+// Calls a function and returns its output, used for completion functions
+func CallCaptured(env *env.Env, name string, args []string) (string, error) {
+	body, ok := env.GetFunc(name)
+	if !ok {
+		return "", fmt.Errorf("Function %v not found", utils.Quote(name))
+	}
+
+	fork, output := capture(env)
+
+	// The processes must not take the terminal from the prompt, so they are put in a background
+	// job
+	fork.Job = env.Jobs.New(name, false)
+	defer env.Jobs.Remove(fork.Job)
+
+	_, err := evalCall(fork, body, args)
+
+	return output(), err
+}
@@ -0,0 +1,169 @@
+package evaluator
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Glob patterns support '*', '?' and '[...]' like filepath.Match, and '**' as a whole path element
+// which matches any number of directories. A backslash escapes the special characters
+
+func isGlobChar(char byte) bool {
+	return char == '*' || char == '?' || char == '['
+}
+
+// Escapes the special characters of a text which should match literally
+func escapeGlob(text string) string {
+	escaped := ""
+	for i := 0; i < len(text); i ++ {
+		if isGlobChar(text[i]) || text[i] == '\\' {
+			escaped += "\\"
+		}
+
+		escaped += text[i:i + 1]
+	}
+
+	return escaped
+}
+
+func unescapeGlob(pattern string) string {
+	unescaped := ""
+	for i := 0; i < len(pattern); i ++ {
+		if pattern[i] == '\\' && i + 1 < len(pattern) {
+			i ++
+		}
+
+		unescaped += pattern[i:i + 1]
+	}
+
+	return unescaped
+}
+
+// Does the pattern have any unescaped special characters?
+func hasGlobChars(pattern string) bool {
+	for i := 0; i < len(pattern); i ++ {
+		if pattern[i] == '\\' {
+			i ++
+		} else if isGlobChar(pattern[i]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Returns the sorted paths matching the pattern, hidden files only match if the pattern element
+// starts with a dot. Relative patterns match in the directory cwd. Malformed patterns match nothing
+func glob(cwd, pattern string) []string {
+	elems := strings.Split(pattern, "/")
+
+	dir := ""
+	if strings.HasPrefix(pattern, "/") {
+		dir   = "/"
+		elems = elems[1:]
+	}
+
+	var matches []string
+	globDir(cwd, dir, elems, &matches)
+
+	sort.Strings(matches)
+
+	// '**' can reach the same path in more ways
+	for i := 1; i < len(matches); i ++ {
+		if matches[i] == matches[i - 1] {
+			matches = append(matches[:i], matches[i + 1:]...)
+			i --
+		}
+	}
+
+	return matches
+}
+
+// Matches the pattern elements in the directory, dir is the matched path so far
+func globDir(cwd, dir string, elems []string, matches *[]string) {
+	if len(elems) == 0 {
+		*matches = append(*matches, dir)
+
+		return
+	}
+
+	elem, rest := elems[0], elems[1:]
+
+	// A trailing slash only matches directories
+	if len(elem) == 0 {
+		if len(rest) == 0 {
+			if info, err := os.Stat(dirPath(cwd, dir)); err == nil && info.IsDir() {
+				*matches = append(*matches, dir)
+			}
+		} else {
+			globDir(cwd, dir, rest, matches)
+		}
+
+		return
+	}
+
+	// Literal elements are just joined, they only need to exist
+	if !hasGlobChars(elem) {
+		path := dir + unescapeGlob(elem)
+		if _, err := os.Lstat(dirPath(cwd, path)); err == nil {
+			globDir(cwd, withSlash(path, rest), rest, matches)
+		}
+
+		return
+	}
+
+	entries, err := os.ReadDir(dirPath(cwd, dir))
+	if err != nil {
+		return // Not a directory or not readable, nothing matches
+	}
+
+	if elem == "**" {
+		// '**' at the end matches all the files and directories
+		if len(rest) == 0 {
+			rest = []string{"*"}
+		}
+
+		// No directories at all
+		globDir(cwd, dir, rest, matches)
+
+		// Any number of directories, symbolic links are not followed so there are no cycles
+		for _, entry := range entries {
+			if entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				globDir(cwd, dir + entry.Name() + "/", elems, matches)
+			}
+		}
+
+		return
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(elem, ".") {
+			continue
+		}
+
+		if ok, _ := filepath.Match(elem, name); ok {
+			globDir(cwd, withSlash(dir + name, rest), rest, matches)
+		}
+	}
+}
+
+// Path of a matched path in the file system
+func dirPath(cwd, dir string) string {
+	if filepath.IsAbs(dir) {
+		return dir
+	}
+
+	return filepath.Join(cwd, dir)
+}
+
+// Adds a slash after a path when more elements follow
+func withSlash(path string, rest []string) string {
+	if len(rest) > 0 {
+		return path + "/"
+	}
+
+	return path
+}
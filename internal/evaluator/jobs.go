@@ -0,0 +1,232 @@
+package evaluator
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/LordOfTrident/snash/pkg/term"
+
+	"github.com/LordOfTrident/snash/internal/utils"
+	"github.com/LordOfTrident/snash/internal/errors"
+	"github.com/LordOfTrident/snash/internal/token"
+	"github.com/LordOfTrident/snash/internal/node"
+	"github.com/LordOfTrident/snash/internal/env"
+	"github.com/LordOfTrident/snash/internal/jobs"
+	"github.com/LordOfTrident/snash/internal/highlighter"
+)
+
+// Describes a statement in the job list
+func jobText(s node.Statement) string {
+	switch s := s.(type) {
+	case *node.CmdStatement:
+		words := []string{s.Cmd.Token.Data}
+		for _, arg := range s.Args {
+			words = append(words, arg.Token.Data)
+		}
+
+		return strings.Join(words, " ")
+
+	case *node.PipeStatement:
+		var stages []string
+		for _, stage := range s.Stages {
+			stages = append(stages, jobText(stage))
+		}
+
+		return strings.Join(stages, " | ")
+
+	case *node.BinOpStatement: return jobText(s.Left) + " " + s.Token.Data + " " + jobText(s.Right)
+
+	default: return s.NodeToken().Data + " ..."
+	}
+}
+
+// Runs an external process. In the foreground of the shell every process is a job of its own,
+// otherwise it is a part of the job being evaluated
+func runProcess(env *env.Env, process *exec.Cmd, text string) int {
+	if env.Job != nil {
+		pid, err := env.Jobs.Start(env.Job, process)
+		if err != nil {
+			panic(err)
+		}
+
+		ex := env.Jobs.WaitProcess(env.Job, pid)
+
+		// With job control only the job gets the signal from the terminal, so the shell has to
+		// stop evaluating by itself
+		if ex == exInterrupted && env.Jobs.InForeground(env.Job) {
+			term.Interrupt()
+		}
+
+		return ex
+	}
+
+	job := env.Jobs.New(text, true)
+
+	pid, err := env.Jobs.Start(job, process)
+	if err != nil {
+		env.Jobs.Remove(job)
+
+		panic(err)
+	}
+
+	go func() {
+		env.Jobs.Finish(job, env.Jobs.WaitProcess(job, pid))
+	}()
+
+	ex, _ := waitForeground(env, job)
+
+	return ex
+}
+
+// Waits until a foreground job finishes or stops and takes the terminal back
+func waitForeground(env *env.Env, job *jobs.Job) (ex int, stopped bool) {
+	state := env.Jobs.Wait(job)
+	env.Jobs.TakeTerminal()
+
+	// A stopped job stays in the job list
+	if state == jobs.Stopped {
+		env.Jobs.Notified(job)
+		fmt.Fprintf(env.Stderr, "\n%v\n", env.Jobs.Describe(job))
+
+		return 128 + int(syscall.SIGTSTP), true
+	}
+
+	env.Jobs.Remove(job)
+
+	if job.Ex == exInterrupted {
+		// The terminal echoes '^C' without a new line
+		if env.Jobs.Control {
+			fmt.Fprintln(env.Stderr)
+		}
+
+		// The job took the interrupt from the shell, the rest of the input is not evaluated
+		term.Interrupt()
+	}
+
+	return job.Ex, false
+}
+
+func evalBackground(env *env.Env, bs *node.BackgroundStatement) {
+	job := env.Jobs.New(jobText(bs.Body), false)
+
+	fork := env.Fork()
+	fork.Job = job
+
+	go func() {
+		ex, err := evalStatement(fork, bs.Body)
+		if err != nil {
+			highlighter.PrintError("%v", err)
+		}
+
+		env.Jobs.Finish(job, ex)
+	}()
+
+	if env.Jobs.Control {
+		fmt.Fprintf(env.Stderr, "[%v] %v\n", job.ID, job.Cmd)
+	}
+}
+
+// Finds the job from a job builtin argument like '%1' or '1', without an argument it is the
+// latest job
+func findJob(env *env.Env, js *node.JobStatement, args []string, i int) (*jobs.Job, error) {
+	if i >= len(args) {
+		if job := env.Jobs.Get(0); job != nil {
+			return job, nil
+		}
+
+		return nil, errors.New(js.Token.Where, "No current job")
+	}
+
+	where := js.Args[i].NodeToken().Where
+
+	id, err := strconv.Atoi(strings.TrimPrefix(args[i], "%"))
+	if err != nil || id <= 0 {
+		return nil, errors.New(where, "Invalid job %v", utils.Quote(args[i]))
+	}
+
+	job := env.Jobs.Get(id)
+	if job == nil {
+		return nil, errors.New(where, "No such job %v", utils.Quote(args[i]))
+	}
+
+	return job, nil
+}
+
+func evalJob(env *env.Env, js *node.JobStatement) (int, error) {
+	args, err := expandWords(env, js.Args)
+	if err != nil {
+		return 1, err
+	}
+
+	switch js.Token.Type {
+	case token.Jobs:
+		if len(args) > 0 {
+			return 1, errors.New(js.Args[0].NodeToken().Where,
+			                     "Unexpected argument %v", utils.Quote(args[0]))
+		}
+
+		for _, desc := range env.Jobs.List() {
+			fmt.Fprintln(env.Stdout, desc)
+		}
+
+	case token.Fg, token.Bg:
+		if len(args) > 1 {
+			return 1, errors.New(js.Args[1].NodeToken().Where,
+			                     "Unexpected argument %v", utils.Quote(args[1]))
+		}
+
+		job, err := findJob(env, js, args, 0)
+		if err != nil {
+			return 1, err
+		}
+
+		if js.Token.Type == token.Bg {
+			env.Jobs.Continue(job, false)
+			fmt.Fprintln(env.Stderr, env.Jobs.Describe(job))
+
+			break
+		}
+
+		fmt.Fprintln(env.Stderr, job.Cmd)
+		env.Jobs.Continue(job, true)
+
+		ex, _ := waitForeground(env, job)
+
+		return ex, nil
+
+	// Wait for the given jobs, or all of them
+	case token.Wait:
+		list := env.Jobs.Unfinished()
+		if len(args) > 0 {
+			list = nil
+			for i := range args {
+				job, err := findJob(env, js, args, i)
+				if err != nil {
+					return 1, err
+				}
+
+				list = append(list, job)
+			}
+		}
+
+		ex := 0
+		for _, job := range list {
+			if env.Jobs.Wait(job) == jobs.Done {
+				ex = job.Ex
+
+				// There is no need to notify about the jobs which were waited for
+				env.Jobs.Notified(job)
+				env.Jobs.Remove(job)
+			}
+		}
+
+		return ex, nil
+
+	default: return 1, errors.UnexpectedNode(js)
+	}
+
+	return 0, nil
+}
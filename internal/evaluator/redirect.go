@@ -0,0 +1,94 @@
+package evaluator
+
+import (
+	"os"
+
+	"github.com/LordOfTrident/snash/internal/utils"
+	"github.com/LordOfTrident/snash/internal/errors"
+	"github.com/LordOfTrident/snash/internal/token"
+	"github.com/LordOfTrident/snash/internal/node"
+	"github.com/LordOfTrident/snash/internal/env"
+)
+
+func getStream(env *env.Env, fd int) **os.File {
+	switch fd {
+	case 0: return &env.Stdin
+	case 1: return &env.Stdout
+	case 2: return &env.Stderr
+
+	default: return nil
+	}
+}
+
+// Applies the redirections to the streams of the environment, returns a function which restores
+// the previous streams and closes the opened files
+func redirect(env *env.Env, redirects []node.Redirect) (restore func(), err error) {
+	stdin, stdout, stderr := env.Stdin, env.Stdout, env.Stderr
+
+	var opened []*os.File
+
+	restore = func() {
+		env.Stdin, env.Stdout, env.Stderr = stdin, stdout, stderr
+
+		for _, f := range opened {
+			f.Close()
+		}
+	}
+
+	for _, r := range redirects {
+		stream := getStream(env, r.Fd)
+		if stream == nil {
+			restore()
+
+			return nil, errors.New(r.Token.Where, "Unsupported file descriptor %v", r.Fd)
+		}
+
+		// Duplications just copy the stream of another file descriptor
+		if r.Token.Type == token.RedirectDup {
+			dup := getStream(env, r.DupFd)
+			if dup == nil {
+				restore()
+
+				return nil, errors.New(r.Token.Where, "Unsupported file descriptor %v", r.DupFd)
+			}
+
+			*stream = *dup
+
+			continue
+		}
+
+		path, err := expandWord(env, r.Target)
+		if err != nil {
+			restore()
+
+			return nil, err
+		}
+
+		var flags int
+		switch r.Token.Type {
+		case token.RedirectIn:     flags = os.O_RDONLY
+		case token.RedirectAppend: flags = os.O_WRONLY | os.O_CREATE | os.O_APPEND
+
+		default: flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+
+		f, err := os.OpenFile(env.Path(path), flags, 0644)
+		if err != nil {
+			restore()
+
+			return nil, errors.New(r.Target.NodeToken().Where, "Could not open file %v",
+			                       utils.Quote(path))
+		}
+
+		opened = append(opened, f)
+
+		*stream = f
+
+		// '&>' redirects stderr to the same file too
+		if r.Token.Type == token.RedirectAll {
+			env.Stderr = f
+		}
+	}
+
+	return restore, nil
+}
@@ -0,0 +1,97 @@
+package evaluator
+
+import (
+	"os/user"
+	"strings"
+
+	"github.com/LordOfTrident/snash/internal/token"
+	"github.com/LordOfTrident/snash/internal/node"
+	"github.com/LordOfTrident/snash/internal/env"
+)
+
+// Tilde expansion replaces an unquoted '~' at the start of a word with $HOME, '~user' with the
+// home directory of the user, '~+' with $PWD and '~-' with $OLDPWD. The prefix ends at the first
+// '/', in assignment values also at ':' and another prefix can follow each ':'
+
+// Directory of a tilde prefix without the '~', ok is false if it does not expand
+func tildeDir(env *env.Env, name string) (dir string, ok bool) {
+	switch name {
+	case "":  return env.GetVar("HOME")
+	case "+": return env.GetVar("PWD")
+	case "-": return env.GetVar("OLDPWD")
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", false
+	}
+
+	return u.HomeDir, true
+}
+
+func expandTilde(env *env.Env, word node.Word, assign bool) node.Word {
+	parts := word.Token.Parts
+	if len(parts) == 0 {
+		return word
+	}
+
+	var expanded []token.Part
+	for i, part := range parts {
+		if part.Type != token.PartText || part.Quoted {
+			expanded = append(expanded, part)
+
+			continue
+		}
+
+		// A prefix has to be the whole rest of the word if it is not ended by a slash, so it can
+		// not continue in the next part
+		last := i == len(parts) - 1
+
+		text := part.Data
+		for start := 0; start < len(text); {
+			// Where the next prefix can start
+			next := len(text)
+			if assign {
+				if idx := strings.IndexByte(text[start:], ':'); idx != -1 {
+					next = start + idx + 1
+				}
+			}
+
+			if text[start] == '~' && (start > 0 || i == 0) {
+				end := len(text)
+				if idx := strings.IndexAny(text[start:], tildeEnds(assign)); idx != -1 {
+					end = start + idx
+				}
+
+				if end < len(text) || last {
+					if dir, ok := tildeDir(env, text[start + 1:end]); ok {
+						// The directory is quoted, so it is not expanded any further
+						expanded = append(expanded, token.Part{Type: token.PartText, Data: dir,
+						                                       Quoted: true, Where: part.Where})
+
+						start = end
+					}
+				}
+			}
+
+			if start < next {
+				expanded = append(expanded, token.Part{Type: token.PartText,
+				                                       Data: text[start:next], Where: part.Where})
+			}
+
+			start = next
+		}
+	}
+
+	word.Token.Parts = expanded
+
+	return word
+}
+
+func tildeEnds(assign bool) string {
+	if assign {
+		return "/:"
+	}
+
+	return "/"
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 	"unicode"
 
@@ -31,6 +32,7 @@ const (
 	colorString = term.AttrBrightGreen
 	colorEscape = term.AttrBrightMagenta
 	colorVar    = term.AttrBrightCyan
+	colorBrace  = term.AttrBold + term.AttrCyan
 )
 
 type Highlighter struct {
@@ -54,13 +56,24 @@ func (h *Highlighter) Highlight(code, path string) (out string, firstErr error)
 		}
 	}
 
+	// The token columns and lengths count characters, not bytes
+	runes := []rune(code)
+
+	// Where each line starts in the code, to find the tokens from their rows and columns
+	lineStarts := []int{0}
+	for i, ch := range runes {
+		if ch == '\n' {
+			lineStarts = append(lineStarts, i + 1)
+		}
+	}
+
 	for i, tok := range toks {
 		// If an error was found, only report it if it is the first error
 		if tok.Type == token.Error && firstErr == nil {
 			firstErr = errors.ErrorTokenToError(tok)
 		}
 
-		next, err := highlightNext(toks, i, code)
+		next, err := h.highlightNext(toks, i, runes, lineStarts)
 		if err != nil && firstErr == nil {
 			firstErr = err
 		}
@@ -68,12 +81,46 @@ func (h *Highlighter) Highlight(code, path string) (out string, firstErr error)
 		out += next
 	}
 
+	if firstErr == nil {
+		firstErr = checkBlocks(toks)
+	}
+
 	out += term.AttrReset
 
 	return
 }
 
-func cmdExists(name string) bool {
+// Makes sure all the blocks are closed and there are no unexpected closing braces
+func checkBlocks(toks []token.Token) error {
+	var open []token.Token
+	for i := range toks {
+		switch toks[i].Type {
+		case token.LBrace: open = append(open, toks[i])
+
+		case token.RBrace:
+			if len(open) == 0 {
+				return errors.UnexpectedToken(&toks[i])
+			}
+
+			open = open[:len(open) - 1]
+		}
+	}
+
+	if len(open) > 0 {
+		return errors.BlockNotClosed(open[len(open) - 1].Where)
+	}
+
+	return nil
+}
+
+func (h *Highlighter) cmdExists(name string) bool {
+	// Aliases and functions are valid commands too
+	if _, ok := h.env.Aliases[name]; ok {
+		return true
+	} else if _, ok := h.env.GetFunc(name); ok {
+		return true
+	}
+
 	_, err := exec.LookPath(name)
 
 	return err == nil
@@ -83,7 +130,7 @@ func isCmd(toks []token.Token, i int) (isCmd bool) {
 	// Would the token be parsed as a command?
 	isCmd = true
 	if i > 0 {
-		if !toks[i - 1].IsArgsEnd() {
+		if !toks[i - 1].ExpectsStatement() {
 			isCmd = false
 		}
 	}
@@ -194,24 +241,48 @@ func HighlightStrings(str string) (ret string) {
 	return
 }
 
-func highlightNext(toks []token.Token, i int, code string) (highlighted string, err error) {
+// Finds the index of a token in the code
+func offset(where token.Where, code []rune, lineStarts []int) int {
+	off := len(code)
+	if where.Row - 1 < len(lineStarts) {
+		off = lineStarts[where.Row - 1] + where.Col - 1
+	}
+
+	if off > len(code) {
+		return len(code)
+	} else if off < 0 {
+		return 0
+	}
+
+	return off
+}
+
+func (h *Highlighter) highlightNext(toks []token.Token, i int, code []rune,
+                                    lineStarts []int) (highlighted string, err error) {
 	tok := toks[i]
-	col := tok.Where.Col - 1
+	col := offset(tok.Where, code, lineStarts)
 
 	prevCol := 0
 	if i > 0 {
-		prevCol = (toks[i - 1].Where.Col - 1 + toks[i - 1].TxtLen)
+		prevCol = offset(toks[i - 1].Where, code, lineStarts) + toks[i - 1].TxtLen
 	}
 
 	// If there is a space between this and the previous token
 	if col - prevCol > 0 {
 		// Save the ignored characters in between tokens and color the comments
-		highlighted += strings.Replace(code[prevCol:col], "#", colorComment + "#", -1)
+		highlighted += strings.Replace(string(code[prevCol:col]), "#", colorComment + "#", -1)
 	}
 
 	if tok.Type != token.EOF {
-		// Get the raw token text
-		txt := code[col:col + tok.TxtLen]
+		// Get the raw token text, tokens spanning multiple lines might not know their length
+		end := col + tok.TxtLen
+		if end > len(code) {
+			end = len(code)
+		} else if end < col {
+			end = col
+		}
+
+		txt := string(code[col:end])
 
 		isCmd := isCmd(toks, i)
 
@@ -222,10 +293,10 @@ func highlightNext(toks []token.Token, i int, code string) (highlighted string,
 		default:
 			if tok.IsKeyword() {
 				highlighted += colorKeyword + txt
-			} else if tok.IsOp() {
+			} else if tok.IsOp() || tok.IsBrace() {
 				highlighted += colorOperator + txt
 			} else if isCmd { // Is the current token a command?
-				if cmdExists(tok.Data) {
+				if h.cmdExists(tok.Data) {
 					highlighted += colorCmd + txt
 				} else {
 					err = errors.CmdNotFound(tok.Data, tok.Where)
@@ -236,7 +307,7 @@ func highlightNext(toks []token.Token, i int, code string) (highlighted string,
 			                                                 // file path argument?
 				highlighted += colorPath + txt
 			} else {
-				highlighted += HighlightStrings(txt)
+				highlighted += highlightWord(txt)
 			}
 		}
 	}
@@ -245,3 +316,80 @@ func highlightNext(toks []token.Token, i int, code string) (highlighted string,
 
 	return
 }
+
+// Highlights a word like a string, with its brace groups colored
+func highlightWord(txt string) (highlighted string) {
+	prev := 0
+	for _, span := range braceDelims(txt) {
+		highlighted += HighlightStrings(txt[prev:span[0]]) + term.AttrReset +
+		               colorBrace + txt[span[0]:span[1]] + term.AttrReset
+
+		prev = span[1]
+	}
+
+	return highlighted + HighlightStrings(txt[prev:])
+}
+
+// Finds the braces, commas and '..' of the unquoted brace groups which expand, the spans are
+// sorted
+func braceDelims(txt string) (spans [][2]int) {
+	type group struct {
+		start  int
+		commas [][2]int
+	}
+
+	var open []group
+	apostrophe := byte(0)
+	escape     := false
+	for i := 0; i < len(txt); i ++ {
+		ch := txt[i]
+		if apostrophe != 0 {
+			if escape {
+				escape = false
+			} else if ch == '\\' && apostrophe != '\'' {
+				escape = true
+			} else if ch == apostrophe {
+				apostrophe = 0
+			}
+
+			continue
+		}
+
+		switch ch {
+		case '\'', '"', '`': apostrophe = ch
+		case '{':           open = append(open, group{start: i})
+		case ',':
+			if len(open) > 0 {
+				open[len(open) - 1].commas = append(open[len(open) - 1].commas, [2]int{i, i + 1})
+			}
+
+		case '}':
+			if len(open) == 0 {
+				continue
+			}
+
+			g   := open[len(open) - 1]
+			open = open[:len(open) - 1]
+
+			// Sequences have no commas and no nested groups
+			var delims [][2]int
+			if len(g.commas) > 0 {
+				delims = g.commas
+			} else if dots := strings.Index(txt[g.start:i], ".."); dots != -1 &&
+			          !strings.ContainsAny(txt[g.start + 1:i], "{}'\"`$") {
+				delims = [][2]int{{g.start + dots, g.start + dots + 2}}
+			} else {
+				continue
+			}
+
+			spans = append(spans, [2]int{g.start, g.start + 1}, [2]int{i, i + 1})
+			spans = append(spans, delims...)
+		}
+	}
+
+	sort.Slice(spans, func(a, b int) bool {
+		return spans[a][0] < spans[b][0]
+	})
+
+	return
+}
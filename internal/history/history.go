@@ -0,0 +1,192 @@
+package history
+
+import (
+	"os"
+	"bufio"
+	"strings"
+	"syscall"
+	"encoding/json"
+)
+
+// One line of the history file
+type Entry struct {
+	Cmd      string  `json:"cmd"`
+	Time     int64   `json:"time"`     // Unix time of when the command was run
+	Duration float64 `json:"duration"` // In seconds
+	Cwd      string  `json:"cwd"`
+	Ex       int     `json:"ex"`
+}
+
+type History struct {
+	Path    string // Empty if the history is not saved
+	Entries []Entry
+
+	MaxSize int // Maximum count of entries, 0 means no limit
+
+	IgnoreDups  bool // Dont add a command which is the same as the previous one
+	IgnoreSpace bool // Dont add commands starting with a space
+}
+
+func New() *History {
+	return &History{}
+}
+
+// Reads the history file. The file is rewritten if it has more entries than allowed or is in the
+// old plain text format
+func (h *History) Load(path string) error {
+	h.Path = path
+
+	return h.locked(os.O_RDWR, func(f *os.File) error {
+		entries, plain := read(f)
+
+		h.Entries = h.trim(entries)
+		if plain || len(h.Entries) < len(entries) {
+			return write(f, h.Entries)
+		}
+
+		return nil
+	})
+}
+
+// Adds an entry and appends it to the history file, unless the options say it should be ignored
+func (h *History) Add(entry Entry) error {
+	if len(strings.TrimSpace(entry.Cmd)) == 0 {
+		return nil
+	} else if h.IgnoreSpace && strings.HasPrefix(entry.Cmd, " ") {
+		return nil
+	} else if h.IgnoreDups && len(h.Entries) > 0 && h.Entries[len(h.Entries) - 1].Cmd == entry.Cmd {
+		return nil
+	}
+
+	h.Entries = h.trim(append(h.Entries, entry))
+
+	if len(h.Path) == 0 {
+		return nil
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	// Other shells might be appending at the same time
+	return h.locked(os.O_WRONLY | os.O_APPEND, func(f *os.File) error {
+		_, err := f.Write(append(data, '\n'))
+
+		return err
+	})
+}
+
+// Removes an entry, the history file is read again because other shells might have added entries
+// to it since it was loaded
+func (h *History) Delete(idx int) error {
+	entry := h.Entries[idx]
+	h.Entries = append(h.Entries[:idx:idx], h.Entries[idx + 1:]...)
+
+	if len(h.Path) == 0 {
+		return nil
+	}
+
+	return h.locked(os.O_RDWR, func(f *os.File) error {
+		entries, _ := read(f)
+		for i := range entries {
+			if entries[i] == entry {
+				entries = append(entries[:i], entries[i + 1:]...)
+
+				break
+			}
+		}
+
+		return write(f, entries)
+	})
+}
+
+// Returns the indexes of the entries containing the query
+func (h *History) Search(query string) (found []int) {
+	for i, entry := range h.Entries {
+		if strings.Contains(entry.Cmd, query) {
+			found = append(found, i)
+		}
+	}
+
+	return
+}
+
+func (h *History) Cmds() (cmds []string) {
+	for _, entry := range h.Entries {
+		cmds = append(cmds, entry.Cmd)
+	}
+
+	return
+}
+
+// Only keeps the newest entries
+func (h *History) trim(entries []Entry) []Entry {
+	if h.MaxSize > 0 && len(entries) > h.MaxSize {
+		return entries[len(entries) - h.MaxSize:]
+	}
+
+	return entries
+}
+
+// Opens the history file and holds a lock on it while f runs
+func (h *History) locked(flag int, f func(*os.File) error) error {
+	file, err := os.OpenFile(h.Path, flag | os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+
+	return f(file)
+}
+
+// Reads the entries of a history file, plain is true if some of the lines were in the old plain
+// text format
+func read(f *os.File) (entries []Entry, plain bool) {
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1024 * 1024) // Allow long commands
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if len(line) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil || len(entry.Cmd) == 0 {
+			entry = Entry{Cmd: line}
+			plain = true
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return
+}
+
+func write(f *os.File, entries []Entry) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+
+	if _, err := f.Seek(0, 0); err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, entry := range entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		w.Write(append(data, '\n'))
+	}
+
+	return w.Flush()
+}
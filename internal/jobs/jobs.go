@@ -0,0 +1,460 @@
+package jobs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/LordOfTrident/snash/pkg/term"
+)
+
+type State int
+const (
+	Running State = iota
+	Stopped
+	Done
+)
+
+func (state State) String() string {
+	switch state {
+	case Running: return "Running"
+	case Stopped: return "Stopped"
+	case Done:    return "Done"
+
+	default: panic("Unreachable")
+	}
+}
+
+type process struct {
+	process *os.Process
+
+	exited bool
+	ex     int
+}
+
+type Job struct {
+	ID   int
+	Cmd  string
+	Pgid int
+
+	State State
+	Ex    int
+
+	Foreground bool
+
+	procs    []*process
+	notified State // The last state the user was notified about
+}
+
+// The state is changed by the reaper, so the job is only described with the table locked
+func (job *Job) describe() string {
+	return fmt.Sprintf("[%v]  %-8v %v", job.ID, job.State, job.Cmd)
+}
+
+type Table struct {
+	Control bool // Is job control enabled?
+
+	jobs []*Job
+	fg   *Job // The foreground job which is being waited for
+
+	mu   sync.Mutex
+	cond *sync.Cond
+
+	pgid int      // Process group of the shell
+	tty  *os.File // Terminal for the foreground handoff
+	mode string   // Terminal mode of the shell
+}
+
+func NewTable() *Table {
+	t := &Table{}
+	t.cond = sync.NewCond(&t.mu)
+
+	// Reap the processes whenever a child changes its state
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGCHLD)
+
+	go func() {
+		for {
+			<- c
+			t.Reap()
+		}
+	}()
+
+	return t
+}
+
+// Enables job control, which puts every job into its own process group and gives the terminal
+// to the foreground jobs
+func (t *Table) EnableControl() error {
+	tty, err := term.OpenTTY()
+	if err != nil {
+		return err
+	}
+
+	t.tty  = tty
+	t.pgid = syscall.Getpgrp()
+	t.mode = term.SaveMode()
+
+	// The terminal stop signals are caught (not ignored, because children would inherit that) so
+	// they do not stop the shell
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU)
+
+	go func() {
+		for {
+			<- c
+		}
+	}()
+
+	t.Control = true
+
+	return nil
+}
+
+// Gives the terminal back to the shell after a foreground job stopped or finished, the job might
+// have changed the terminal mode
+func (t *Table) TakeTerminal() {
+	if t.Control {
+		term.SetForeground(t.tty, t.pgid)
+		term.RestoreMode(t.mode)
+	}
+}
+
+// Creates a new job with the smallest free ID
+func (t *Table) New(cmd string, foreground bool) *Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job := &Job{ID: 1, Cmd: cmd, Foreground: foreground}
+	for _, other := range t.jobs {
+		if other.ID >= job.ID {
+			job.ID = other.ID + 1
+		}
+	}
+
+	t.jobs = append(t.jobs, job)
+
+	return job
+}
+
+func (t *Table) Remove(job *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.remove(job)
+}
+
+func (t *Table) remove(job *Job) {
+	for i, other := range t.jobs {
+		if other == job {
+			t.jobs = append(t.jobs[:i], t.jobs[i + 1:]...)
+
+			break
+		}
+	}
+}
+
+// Starts a process of the job and returns its PID, the first process creates the process group
+// of the job
+func (t *Table) Start(job *Job, cmd *exec.Cmd) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.Control {
+		cmd.SysProcAttr = t.procAttr(job)
+	}
+
+	err := cmd.Start()
+
+	// The process group does not exist anymore if all of its processes exited already, so the
+	// process has to create a new one
+	if err != nil && t.Control && job.Pgid != 0 {
+		retry := exec.Command(cmd.Path, cmd.Args[1:]...)
+		retry.Env    = cmd.Env
+		retry.Dir    = cmd.Dir
+		retry.Stdin  = cmd.Stdin
+		retry.Stdout = cmd.Stdout
+		retry.Stderr = cmd.Stderr
+
+		job.Pgid = 0
+		retry.SysProcAttr = t.procAttr(job)
+
+		cmd = retry
+		err = cmd.Start()
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	if job.Pgid == 0 {
+		job.Pgid = cmd.Process.Pid
+	}
+
+	job.procs = append(job.procs, &process{process: cmd.Process})
+
+	return cmd.Process.Pid, nil
+}
+
+func (t *Table) procAttr(job *Job) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pgid: job.Pgid}
+
+	// The first process of a foreground job gives the terminal to the job
+	if job.Pgid == 0 && job.Foreground {
+		attr.Foreground = true
+		attr.Ctty       = int(t.tty.Fd())
+	}
+
+	return attr
+}
+
+// Checks which processes changed their state, called on SIGCHLD
+func (t *Table) Reap() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, job := range t.jobs {
+		for _, p := range job.procs {
+			if p.exited {
+				continue
+			}
+
+			var status syscall.WaitStatus
+			pid, err := syscall.Wait4(p.process.Pid, &status,
+			                          syscall.WNOHANG | syscall.WUNTRACED | syscall.WCONTINUED, nil)
+			if err != nil {
+				// The process was reaped by someone else
+				p.exited = true
+
+				continue
+			} else if pid == 0 {
+				continue
+			}
+
+			switch {
+			case status.Exited():
+				p.exited = true
+				p.ex     = status.ExitStatus()
+
+			case status.Signaled():
+				p.exited = true
+				p.ex     = 128 + int(status.Signal())
+
+			case status.Stopped():
+				if job.State == Running {
+					job.State = Stopped
+				}
+
+			case status.Continued():
+				if job.State == Stopped {
+					job.State = Running
+				}
+			}
+
+			if p.exited {
+				p.process.Release()
+			}
+		}
+	}
+
+	t.cond.Broadcast()
+}
+
+// Waits for a process of the job to exit and returns its exitcode
+func (t *Table) WaitProcess(job *Job, pid int) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, p := range job.procs {
+		if p.process.Pid != pid {
+			continue
+		}
+
+		for !p.exited {
+			t.cond.Wait()
+		}
+
+		return p.ex
+	}
+
+	return 0
+}
+
+// Waits until the job is done or stopped
+func (t *Table) Wait(job *Job) State {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if job.Foreground {
+		t.fg = job
+		defer func() {
+			t.fg = nil
+		}()
+	}
+
+	for job.State == Running {
+		t.cond.Wait()
+	}
+
+	return job.State
+}
+
+// Marks the job as done, called once everything the job evaluates finished
+func (t *Table) Finish(job *Job, ex int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job.State = Done
+	job.Ex    = ex
+
+	t.cond.Broadcast()
+}
+
+// Continues a stopped job in the foreground or in the background
+func (t *Table) Continue(job *Job, foreground bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job.Foreground = foreground
+	if job.State == Stopped {
+		job.State = Running
+	}
+
+	job.notified = Running
+
+	if foreground && t.Control && job.Pgid != 0 {
+		term.SetForeground(t.tty, job.Pgid)
+	}
+
+	t.signal(job, syscall.SIGCONT)
+}
+
+// Sends a signal to all the processes of the job
+func (t *Table) Signal(job *Job, sig syscall.Signal) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.signal(job, sig)
+}
+
+func (t *Table) signal(job *Job, sig syscall.Signal) {
+	// With job control, the job has its own process group
+	if t.Control && job.Pgid != 0 {
+		syscall.Kill(-job.Pgid, sig)
+
+		return
+	}
+
+	for _, p := range job.procs {
+		if !p.exited {
+			p.process.Signal(sig)
+		}
+	}
+}
+
+// Forwards an interrupt signal to the foreground job, returns false if there is none
+func (t *Table) Interrupt(sig syscall.Signal) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.fg == nil {
+		return false
+	}
+
+	t.signal(t.fg, sig)
+
+	return true
+}
+
+// Describes the job like in the job list
+func (t *Table) Describe(job *Job) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return job.describe()
+}
+
+// Is the job in the foreground? Background jobs can be continued in the foreground
+func (t *Table) InForeground(job *Job) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return job.Foreground
+}
+
+// Marks the current state of the job as already reported to the user
+func (t *Table) Notified(job *Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	job.notified = job.State
+}
+
+// Returns the messages about the background jobs which finished or stopped since the last call,
+// finished jobs are removed from the table
+func (t *Table) Notifications() (msgs []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, job := range append([]*Job{}, t.jobs...) {
+		if job.State == Running || job.notified == job.State {
+			continue
+		}
+
+		msgs = append(msgs, job.describe())
+
+		job.notified = job.State
+		if job.State == Done {
+			t.remove(job)
+		}
+	}
+
+	return
+}
+
+// Returns the descriptions of all the jobs
+func (t *Table) List() (list []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, job := range t.jobs {
+		list = append(list, job.describe())
+	}
+
+	return
+}
+
+// Finds a job by its ID, an ID of 0 means the latest job
+func (t *Table) Get(id int) *Job {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if id == 0 && len(t.jobs) > 0 {
+		return t.jobs[len(t.jobs) - 1]
+	}
+
+	for _, job := range t.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// Returns all the jobs which are not done yet
+func (t *Table) Unfinished() (jobs []*Job) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, job := range t.jobs {
+		if job.State != Done {
+			jobs = append(jobs, job)
+		}
+	}
+
+	return
+}
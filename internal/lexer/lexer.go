@@ -2,6 +2,7 @@ package lexer
 
 import (
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/LordOfTrident/snash/internal/errors"
 	"github.com/LordOfTrident/snash/internal/utils"
@@ -11,14 +12,20 @@ import (
 type Lexer struct {
 	where token.Where
 
-	idx  int
+	idx  int  // Byte index of the current character
+	size int  // Byte size of the current character
 	char rune
 
 	source string
+
+	substDepth int // How many command substitutions deep are we?
+
+	// Did the source end in the middle of something which can continue on the next line?
+	Incomplete bool
 }
 
 func New(source, path string) *Lexer {
-	l := &Lexer{where: token.Where{Row: 1, Path: path}, idx: -1, source: source}
+	l := &Lexer{where: token.Where{Row: 1, Path: path}, source: source}
 	l.next()
 
 	return l
@@ -54,6 +61,11 @@ func (l *Lexer) NextToken() (tok token.Token) {
 
 				continue
 			} else {
+				// A backslash at the end continues the line
+				if l.peekChar() == '\x00' {
+					l.Incomplete = true
+				}
+
 				tok = l.lexWord()
 			}
 
@@ -79,6 +91,24 @@ func (l *Lexer) NextToken() (tok token.Token) {
 		case '&': tok = l.lexAnd()
 		case '|': tok = l.lexOr()
 
+		case '>', '<': tok = l.lexRedirect(l.where, "")
+
+		case ')':
+			// End of a command substitution, lexSubst moves past it
+			if l.substDepth > 0 {
+				tok = token.New(token.RParen, ")", l.where, 1)
+			} else {
+				tok = l.lexWord()
+			}
+
+		case '{', '}':
+			// Braces are only block tokens when they are separate words
+			if next := l.peekChar(); next == '\x00' || l.isWordEnd(next) {
+				tok = l.lexBrace()
+			} else {
+				tok = l.lexWord()
+			}
+
 		default:
 			if unicode.IsDigit(l.char) {
 				tok = l.lexInteger()
@@ -102,25 +132,29 @@ func (l *Lexer) skipComment() {
 func (l *Lexer) lexAnd() token.Token {
 	start := l.where
 
-	if l.next(); l.char != '&' {
-		return token.NewError(start, 1,
-		                      "Unexpected character %v, did you mean %v?",
-		                      utils.Quote("&"), utils.Quote("&&"))
-	}
+	switch l.next(); l.char {
+	case '&':
+		l.next()
 
-	l.next()
+		return token.New(token.And, "&&", start, 2)
+
+	// Redirect both stdout and stderr
+	case '>':
+		l.next()
+
+		return token.New(token.RedirectAll, "&>", start, 2)
 
-	return token.New(token.And, "&&", start, 2)
+	// Run in the background
+	default: return token.New(token.Background, "&", start, 1)
+	}
 }
 
 func (l *Lexer) lexOr() token.Token {
 	start := l.where
 
-	// TODO: Add piping
+	// A single '|' is a pipe
 	if l.next(); l.char != '|' {
-		return token.NewError(start, 1,
-		                      "Unexpected character %v, did you mean %v?",
-		                      utils.Quote("|"), utils.Quote("||"))
+		return token.New(token.Pipe, "|", start, 1)
 	}
 
 	l.next()
@@ -128,9 +162,22 @@ func (l *Lexer) lexOr() token.Token {
 	return token.New(token.Or, "||", start, 2)
 }
 
+func (l *Lexer) lexBrace() (tok token.Token) {
+	if l.char == '{' {
+		tok = token.New(token.LBrace, "{", l.where, 1)
+	} else {
+		tok = token.New(token.RBrace, "}", l.where, 1)
+	}
+
+	l.next()
+
+	return
+}
+
 func (l *Lexer) lexWord() token.Token {
-	start := l.where // The starting position of the token
-	str   := ""      // The token data string
+	start    := l.where // The starting position of the token
+	startIdx := l.idx
+	word     := wordBuilder{}
 
 	apostrophe := '\x00' // To save the current apostrophe we are using
 	escape     := false  // Are we inside an escape sequence?
@@ -138,12 +185,17 @@ func (l *Lexer) lexWord() token.Token {
 	isBareWord := true // Could be a keyword
 
 loop:
-	for ; apostrophe != '\x00' || !unicode.IsSpace(l.char) && l.char != ';'; l.next() {
+	for ; apostrophe != '\x00' || !l.isWordEnd(l.char); l.next() {
+		quoted := apostrophe != '\x00'
+
 		switch l.char {
 		case '\x00':
 			if apostrophe == '\x00' {
 				break loop
 			} else {
+				// Only backtick strings can span multiple lines
+				l.Incomplete = apostrophe == '`'
+
 				return token.NewError(start, l.where.Col - start.Col, "String not terminated")
 			}
 
@@ -151,7 +203,7 @@ loop:
 		case '\'', '"', '`':
 			if escape {
 				// If we are escaping the apostrophe, add it to the string
-				str += string(l.char)
+				word.addText(string(l.char), quoted, l.where)
 
 				escape = false
 			} else {
@@ -162,16 +214,16 @@ loop:
 				} else if apostrophe == '\x00' {
 					apostrophe = l.char
 				} else {
-					str += string(l.char)
+					word.addText(string(l.char), quoted, l.where)
 				}
 			}
 
 		case '\\':
 			if apostrophe != '"' && apostrophe != '`' { // Escape sequences are only allowed
 			                                            // inside of " and ` apostrophes
-				str += string(l.char)
+				word.addText(string(l.char), quoted, l.where)
 			} else if escape {
-				str += string(l.char)
+				word.addText(string(l.char), quoted, l.where)
 
 				escape = false
 			} else {
@@ -181,31 +233,54 @@ loop:
 		case '\n':
 			// Multi line strings
 			if apostrophe == '`' {
-				str += string(l.char)
+				word.addText(string(l.char), quoted, l.where)
 			} else {
 				return token.NewError(start, l.where.Col - start.Col, "String exceeds line")
 			}
 
 		case '$':
 			if escape || apostrophe == '\'' {
-				str += "\\$"
+				word.addText("$", quoted, l.where)
 
 				escape = false
+			} else if l.peekChar() == '(' {
+				where := l.where
+				idx   := l.idx
+
+				toks, err := l.lexSubst()
+				if err.Type == token.Error {
+					return err
+				}
+
+				word.addSubst(l.source[idx:l.idx + 1], toks, where)
+
+				isBareWord = false
+			} else if isVarStart(l.peekChar()) {
+				where := l.where
+
+				name, raw, err := l.lexVar()
+				if err.Type == token.Error {
+					return err
+				}
+
+				word.addVar(name, raw, where)
+
+				isBareWord = false // Variables are never keywords
 			} else {
-				str += "$"
+				word.addText("$", quoted, l.where)
 			}
 
 		default:
 			if escape {
 				// Parse the escape sequence
 				switch l.char {
-				case 'e': str += string(27)
-				case 'n': str += string('\n')
-				case 'r': str += string('\r')
-				case 't': str += string('\t')
-				case 'v': str += string('\v')
-				case 'b': str += string('\b')
-				case 'f': str += string('\f')
+				case 'e': word.addText(string(27), quoted, l.where)
+				case 'n': word.addText(string('\n'), quoted, l.where)
+				case 'r': word.addText(string('\r'), quoted, l.where)
+				case 't': word.addText(string('\t'), quoted, l.where)
+				case 'v': word.addText(string('\v'), quoted, l.where)
+				case 'b': word.addText(string('\b'), quoted, l.where)
+				case 'f': word.addText(string('\f'), quoted, l.where)
 
 				default:
 					return token.NewError(start, l.where.Col - start.Col,
@@ -214,7 +289,7 @@ loop:
 
 				escape = false
 			} else {
-				str += string(l.char)
+				word.addText(l.source[l.idx:l.idx + l.size], quoted, l.where)
 			}
 		}
 
@@ -223,36 +298,231 @@ loop:
 		}
 	}
 
+	var tok token.Token
+
+	// The length is not taken from the columns, because strings can span multiple lines
+	txtLen := utf8.RuneCountInString(l.source[startIdx:l.idx])
+
 	// Check if the string is a keyword
 	if isBareWord {
-		return token.New(getBareWordTokenType(str), str, start, l.where.Col - start.Col)
+		tok = token.New(getBareWordTokenType(word.str), word.str, start, txtLen)
 	} else {
-		return token.New(token.Word, str, start, l.where.Col - start.Col)
+		tok = token.New(token.Word, word.str, start, txtLen)
 	}
+
+	tok.Parts = word.parts
+
+	return tok
 }
 
-func getBareWordTokenType(word string) token.Type {
-	switch word {
-	case "help": return token.Help
-	case "exit": return token.Exit
-	case "echo": return token.Echo
-	case "cd":   return token.Cd
+// Characters that end unquoted words and integers
+func (l *Lexer) isWordEnd(char rune) bool {
+	switch char {
+	case ';', '|', '&', '>', '<': return true
+
+	// Closing parenthesis only ends words inside of command substitutions
+	case ')': return l.substDepth > 0
+
+	default: return unicode.IsSpace(char)
+	}
+}
+
+// Helper for building word tokens out of literal text and variable parts
+
+type wordBuilder struct {
+	str   string
+	parts []token.Part
+}
+
+func (w *wordBuilder) addText(text string, quoted bool, where token.Where) {
+	w.str += text
+
+	// Append to the last text part if it is quoted the same way, otherwise start a new one
+	if last := len(w.parts) - 1; last >= 0 && w.parts[last].Type == token.PartText &&
+	                             w.parts[last].Quoted == quoted {
+		w.parts[last].Data += text
+	} else {
+		w.parts = append(w.parts, token.Part{Type: token.PartText, Data: text, Quoted: quoted,
+		                                     Where: where})
+	}
+}
+
+func (w *wordBuilder) addVar(name, raw string, where token.Where) {
+	w.str  += raw
+	w.parts = append(w.parts, token.Part{Type: token.PartVar, Data: name, Where: where})
+}
+
+func (w *wordBuilder) addSubst(raw string, toks []token.Token, where token.Where) {
+	w.str  += raw
+	w.parts = append(w.parts, token.Part{Type: token.PartSubst, Data: raw, Toks: toks,
+	                                     Where: where})
+}
+
+// Lexes the tokens of a command substitution until the closing parenthesis. The lexer is left on
+// the closing parenthesis, because lexWord moves to the next character
+func (l *Lexer) lexSubst() (toks []token.Token, err token.Token) {
+	start := l.where
+
+	// Skip the '$('
+	l.next()
+	l.next()
+
+	l.substDepth ++
+	defer func() {
+		l.substDepth --
+	}()
+
+	for {
+		tok := l.NextToken()
+		switch tok.Type {
+		case token.Error: return nil, tok
+		case token.EOF:
+			l.Incomplete = true
+
+			return nil, token.NewError(start, l.where.Col - start.Col,
+			                           "Command substitution not closed")
+
+		case token.RParen:
+			toks = append(toks, token.NewEOF(tok.Where))
+
+			return
+		}
+
+		toks = append(toks, tok)
+	}
+}
+
+func isVarChar(char rune) bool {
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+}
+
+// Special variables with a single character name
+func isSpecialVar(char rune) bool {
+	switch char {
+	case '?', '#', '@': return true
+
+	default: return false
+	}
+}
+
+func isVarStart(char rune) bool {
+	return isVarChar(char) || isSpecialVar(char) || char == '{'
+}
+
+// Lexes a variable name after a '$', supports both $NAME and ${NAME}. The lexer is left on the
+// last character of the variable, because lexWord moves to the next one
+func (l *Lexer) lexVar() (name, raw string, err token.Token) {
+	start := l.where
+
+	switch l.peekChar() {
+	case '?', '#', '@':
+		l.next()
+
+		name = string(l.char)
+
+	case '{':
+		l.next()
+
+		for l.next(); l.char != '}'; l.next() {
+			if l.char == '\x00' || l.char == '\n' {
+				err = token.NewError(start, l.where.Col - start.Col, "Variable name not terminated")
 
-	case "let":    return token.Let
-	case "export": return token.Export
+				return
+			} else if !isVarChar(l.char) {
+				err = token.NewError(start, l.where.Col - start.Col,
+				                     "Unexpected character \"%c\" in variable name", l.char)
 
-	default: return token.BareWord
+				return
+			}
+
+			name += string(l.char)
+		}
+
+		if len(name) == 0 {
+			err = token.NewError(start, l.where.Col - start.Col + 1, "Empty variable name")
+
+			return
+		}
+
+		raw = "${" + name + "}"
+
+		return
+
+	default:
+		for isVarChar(l.peekChar()) {
+			l.next()
+
+			name += string(l.char)
+		}
 	}
+
+	raw = "$" + name
+
+	return
+}
+
+var keywords = map[string]token.Type{
+	"help": token.Help,
+	"exit": token.Exit,
+	"echo": token.Echo,
+	"cd":   token.Cd,
+
+	"let":    token.Let,
+	"export": token.Export,
+	"set":    token.Set,
+
+	"if":   token.If,
+	"elif": token.Elif,
+	"else": token.Else,
+
+	"while":    token.While,
+	"for":      token.For,
+	"in":       token.In,
+	"break":    token.Break,
+	"continue": token.Continue,
+
+	"fn":     token.Fn,
+	"return": token.Return,
+
+	"alias":   token.Alias,
+	"unalias": token.Unalias,
+
+	"complete": token.Complete,
+	"history":  token.History,
+	"bind":     token.Bind,
+
+	"jobs": token.Jobs,
+	"fg":   token.Fg,
+	"bg":   token.Bg,
+	"wait": token.Wait,
+}
+
+// Names of all the keywords
+func Keywords() (names []string) {
+	for name := range keywords {
+		names = append(names, name)
+	}
+
+	return
+}
+
+func getBareWordTokenType(word string) token.Type {
+	if type_, ok := keywords[word]; ok {
+		return type_
+	}
+
+	return token.BareWord
 }
 
 func (l *Lexer) next() {
-	l.idx ++
+	l.idx += l.size
 
-	// Make sure we wont exceed the source code length
+	// Make sure we wont exceed the source code length. Invalid UTF-8 bytes are read one by one and
+	// kept as they are in the words
 	if l.idx >= len(l.source) {
-		l.char = '\x00'
+		l.char, l.size = '\x00', 0
 	} else {
-		l.char = rune(l.source[l.idx])
+		l.char, l.size = utf8.DecodeRuneInString(l.source[l.idx:])
 	}
 
 	// Update position variables
@@ -265,10 +535,12 @@ func (l *Lexer) next() {
 }
 
 func (l *Lexer) peekChar() rune {
-	if l.idx + 1 >= len(l.source) {
+	if l.idx + l.size >= len(l.source) {
 		return '\x00'
 	} else {
-		return rune(l.source[l.idx + 1])
+		char, _ := utf8.DecodeRuneInString(l.source[l.idx + l.size:])
+
+		return char
 	}
 }
 
@@ -277,7 +549,7 @@ func (l *Lexer) lexInteger() token.Token {
 	str   := ""      // The token data string
 
 	// TODO: make tokens like '123abc' not error and instead be lexer as strings
-	for ; l.char != '\x00' && !unicode.IsSpace(l.char) && l.char != ';'; l.next() {
+	for ; l.char != '\x00' && !l.isWordEnd(l.char); l.next() {
 		if !unicode.IsDigit(l.char) {
 			return token.NewError(start, l.where.Col - start.Col,
 			                      "Unexpected character \"%c\" in number", l.char)
@@ -286,5 +558,47 @@ func (l *Lexer) lexInteger() token.Token {
 		str += string(l.char)
 	}
 
+	// A number right before a redirection is the redirected file descriptor
+	if l.char == '>' || l.char == '<' {
+		return l.lexRedirect(start, str)
+	}
+
 	return token.New(token.Integer, str, start, l.where.Col - start.Col)
 }
+
+// Lexes the redirection operators '>', '>>', '<' and '>&N', all of them optionally prefixed with
+// a file descriptor which was already lexed
+func (l *Lexer) lexRedirect(start token.Where, fd string) token.Token {
+	str := fd + string(l.char)
+
+	if l.char == '<' {
+		l.next()
+
+		return token.New(token.RedirectIn, str, start, l.where.Col - start.Col)
+	}
+
+	switch l.next(); l.char {
+	case '>':
+		l.next()
+
+		return token.New(token.RedirectAppend, str + ">", start, l.where.Col - start.Col)
+
+	case '&':
+		str += string(l.char)
+
+		// Read the file descriptor to duplicate
+		target := ""
+		for l.next(); unicode.IsDigit(l.char); l.next() {
+			target += string(l.char)
+		}
+
+		if len(target) == 0 {
+			return token.NewError(start, l.where.Col - start.Col,
+			                      "Expected a file descriptor after %v", utils.Quote(str))
+		}
+
+		return token.New(token.RedirectDup, str + target, start, l.where.Col - start.Col)
+
+	default: return token.New(token.Redirect, str, start, l.where.Col - start.Col)
+	}
+}
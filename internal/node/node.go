@@ -9,6 +9,40 @@ type Node interface {
 	NodeTypeToString() string
 }
 
+// Words
+
+type Word struct {
+	Token token.Token
+
+	Substs []Statements // Command substitutions, in the same order as in the token parts
+}
+
+func (w *Word) NodeToken() token.Token {
+	return w.Token
+}
+
+func (w *Word) NodeTypeToString() string {
+	return "word"
+}
+
+// Redirections
+
+type Redirect struct {
+	Token token.Token
+
+	Fd     int  // The redirected file descriptor
+	Target Word // The file path
+	DupFd  int  // The duplicated file descriptor, if the token is a duplication
+}
+
+func (r *Redirect) NodeToken() token.Token {
+	return r.Token
+}
+
+func (r *Redirect) NodeTypeToString() string {
+	return "redirection"
+}
+
 // Statements
 
 type Statement interface {
@@ -17,6 +51,14 @@ type Statement interface {
 	statementNode()
 }
 
+// Statements which can have their streams redirected
+
+type RedirectedStatement interface {
+	Statement
+
+	NodeRedirects() []Redirect
+}
+
 // Exit
 
 type ExitStatement struct {
@@ -41,11 +83,16 @@ func (es *ExitStatement) NodeTypeToString() string {
 type EchoStatement struct {
 	Token token.Token
 
-	Msg string
+	Args      []Word
+	Redirects []Redirect
 }
 
 func (echo *EchoStatement) statementNode() {}
 
+func (echo *EchoStatement) NodeRedirects() []Redirect {
+	return echo.Redirects
+}
+
 func (echo *EchoStatement) NodeToken() token.Token {
 	return echo.Token
 }
@@ -59,7 +106,8 @@ func (echo *EchoStatement) NodeTypeToString() string {
 type CdStatement struct {
 	Token token.Token
 
-	Path string
+	Path    Word
+	HasPath bool
 }
 
 func (cd *CdStatement) statementNode() {}
@@ -108,12 +156,312 @@ func (bin *BinOpStatement) NodeTypeToString() string {
 	return "binary operator " + bin.NodeToken().Type.String()
 }
 
+// Block
+
+type Block struct {
+	Token token.Token
+
+	Body Statements
+}
+
+func (b *Block) statementNode() {}
+
+func (b *Block) NodeToken() token.Token {
+	return b.Token
+}
+
+func (b *Block) NodeTypeToString() string {
+	return "block"
+}
+
+// If
+
+type IfStatement struct {
+	Token token.Token
+
+	Cond Statement
+	Body *Block
+	Else Statement // nil, an elif *IfStatement or an else *Block
+}
+
+func (is *IfStatement) statementNode() {}
+
+func (is *IfStatement) NodeToken() token.Token {
+	return is.Token
+}
+
+func (is *IfStatement) NodeTypeToString() string {
+	return "if statement"
+}
+
+// Loops
+
+type WhileStatement struct {
+	Token token.Token
+
+	Cond Statement
+	Body *Block
+}
+
+func (ws *WhileStatement) statementNode() {}
+
+func (ws *WhileStatement) NodeToken() token.Token {
+	return ws.Token
+}
+
+func (ws *WhileStatement) NodeTypeToString() string {
+	return "while statement"
+}
+
+type ForStatement struct {
+	Token token.Token
+
+	Var   string
+	Words []Word
+	Body  *Block
+}
+
+func (fs *ForStatement) statementNode() {}
+
+func (fs *ForStatement) NodeToken() token.Token {
+	return fs.Token
+}
+
+func (fs *ForStatement) NodeTypeToString() string {
+	return "for statement"
+}
+
+// Break and continue
+
+type BreakStatement struct {
+	Token token.Token
+}
+
+func (bs *BreakStatement) statementNode() {}
+
+func (bs *BreakStatement) NodeToken() token.Token {
+	return bs.Token
+}
+
+func (bs *BreakStatement) NodeTypeToString() string {
+	return "break statement"
+}
+
+type ContinueStatement struct {
+	Token token.Token
+}
+
+func (cs *ContinueStatement) statementNode() {}
+
+func (cs *ContinueStatement) NodeToken() token.Token {
+	return cs.Token
+}
+
+func (cs *ContinueStatement) NodeTypeToString() string {
+	return "continue statement"
+}
+
+// Functions
+
+type FnStatement struct {
+	Token token.Token
+
+	Name string
+	Body *Block
+}
+
+func (fs *FnStatement) statementNode() {}
+
+func (fs *FnStatement) NodeToken() token.Token {
+	return fs.Token
+}
+
+func (fs *FnStatement) NodeTypeToString() string {
+	return "function definition"
+}
+
+type ReturnStatement struct {
+	Token token.Token
+
+	Ex    int
+	HasEx bool
+}
+
+func (rs *ReturnStatement) statementNode() {}
+
+func (rs *ReturnStatement) NodeToken() token.Token {
+	return rs.Token
+}
+
+func (rs *ReturnStatement) NodeTypeToString() string {
+	return "return statement"
+}
+
+// Aliases
+
+type AliasStatement struct {
+	Token token.Token
+
+	Name     string
+	Value    Word
+	HasName  bool
+	HasValue bool
+}
+
+func (as *AliasStatement) statementNode() {}
+
+func (as *AliasStatement) NodeToken() token.Token {
+	return as.Token
+}
+
+func (as *AliasStatement) NodeTypeToString() string {
+	return "alias statement"
+}
+
+type UnaliasStatement struct {
+	Token token.Token
+
+	Names []Word
+}
+
+func (us *UnaliasStatement) statementNode() {}
+
+func (us *UnaliasStatement) NodeToken() token.Token {
+	return us.Token
+}
+
+func (us *UnaliasStatement) NodeTypeToString() string {
+	return "unalias statement"
+}
+
+type CompleteStatement struct {
+	Token token.Token
+
+	Args      []Word
+	Redirects []Redirect
+}
+
+func (cs *CompleteStatement) statementNode() {}
+
+func (cs *CompleteStatement) NodeRedirects() []Redirect {
+	return cs.Redirects
+}
+
+func (cs *CompleteStatement) NodeToken() token.Token {
+	return cs.Token
+}
+
+func (cs *CompleteStatement) NodeTypeToString() string {
+	return "complete statement"
+}
+
+type HistoryStatement struct {
+	Token token.Token
+
+	Args      []Word
+	Redirects []Redirect
+}
+
+func (hs *HistoryStatement) statementNode() {}
+
+func (hs *HistoryStatement) NodeRedirects() []Redirect {
+	return hs.Redirects
+}
+
+func (hs *HistoryStatement) NodeToken() token.Token {
+	return hs.Token
+}
+
+func (hs *HistoryStatement) NodeTypeToString() string {
+	return "history statement"
+}
+
+type BindStatement struct {
+	Token token.Token
+
+	Args      []Word
+	Redirects []Redirect
+}
+
+func (bs *BindStatement) statementNode() {}
+
+func (bs *BindStatement) NodeRedirects() []Redirect {
+	return bs.Redirects
+}
+
+func (bs *BindStatement) NodeToken() token.Token {
+	return bs.Token
+}
+
+func (bs *BindStatement) NodeTypeToString() string {
+	return "bind statement"
+}
+
+// Pipeline
+
+type PipeStatement struct {
+	Token token.Token
+
+	Stages []Statement
+}
+
+func (pipe *PipeStatement) statementNode() {}
+
+func (pipe *PipeStatement) NodeToken() token.Token {
+	return pipe.Token
+}
+
+func (pipe *PipeStatement) NodeTypeToString() string {
+	return "pipeline"
+}
+
+// Jobs
+
+type BackgroundStatement struct {
+	Token token.Token
+
+	Body Statement
+}
+
+func (bs *BackgroundStatement) statementNode() {}
+
+func (bs *BackgroundStatement) NodeToken() token.Token {
+	return bs.Token
+}
+
+func (bs *BackgroundStatement) NodeTypeToString() string {
+	return "background statement"
+}
+
+// Builtins working with jobs, the token type tells which one it is
+type JobStatement struct {
+	Token token.Token
+
+	Args      []Word
+	Redirects []Redirect
+}
+
+func (js *JobStatement) statementNode() {}
+
+func (js *JobStatement) NodeRedirects() []Redirect {
+	return js.Redirects
+}
+
+func (js *JobStatement) NodeToken() token.Token {
+	return js.Token
+}
+
+func (js *JobStatement) NodeTypeToString() string {
+	return "job statement"
+}
+
 // Variables
 
 type LetStatement struct {
 	Token token.Token
 
-	Name, Value string
+	Name  string
+	Value Word
 }
 
 func (let *LetStatement) statementNode() {}
@@ -129,7 +477,8 @@ func (let *LetStatement) NodeTypeToString() string {
 type AssignStatement struct {
 	Token token.Token
 
-	Name, Value string
+	Name  string
+	Value Word
 }
 
 func (as *AssignStatement) statementNode() {}
@@ -158,17 +507,45 @@ func (export *ExportStatement) NodeTypeToString() string {
 	return "export statement"
 }
 
+// Set
+
+type SetStatement struct {
+	Token token.Token
+
+	Args      []Word
+	Redirects []Redirect
+}
+
+func (set *SetStatement) statementNode() {}
+
+func (set *SetStatement) NodeRedirects() []Redirect {
+	return set.Redirects
+}
+
+func (set *SetStatement) NodeToken() token.Token {
+	return set.Token
+}
+
+func (set *SetStatement) NodeTypeToString() string {
+	return "set statement"
+}
+
 // Command
 
 type CmdStatement struct {
 	Token token.Token
 
-	Cmd  string
-	Args []string
+	Cmd       Word
+	Args      []Word
+	Redirects []Redirect
 }
 
 func (cs *CmdStatement) statementNode() {}
 
+func (cs *CmdStatement) NodeRedirects() []Redirect {
+	return cs.Redirects
+}
+
 func (cs *CmdStatement) NodeToken() token.Token {
 	return cs.Token
 }
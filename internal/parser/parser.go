@@ -2,6 +2,7 @@ package parser
 
 import (
 	"strconv"
+	"strings"
 
 	"github.com/LordOfTrident/snash/internal/errors"
 	"github.com/LordOfTrident/snash/internal/token"
@@ -36,6 +37,22 @@ func NewFromTokens(toks []token.Token) *Parser {
 	return p
 }
 
+// Does the source need more lines to be complete? It does if it ends inside of a backtick string,
+// a block, after a binary operator or with a backslash
+func NeedsMore(source string) bool {
+	l := lexer.New(source, "")
+
+	toks, err := l.Lex()
+	if err != nil || l.Incomplete {
+		return l.Incomplete
+	}
+
+	// The parser ran out of tokens inside of a block or after an operator
+	_, err = NewFromTokens(toks).Parse()
+
+	return errors.IsIncomplete(err)
+}
+
 func (p *Parser) Parse() (node.Statements, error) {
 	var statements node.Statements
 
@@ -70,11 +87,23 @@ func (p *Parser) NextStatement() (node.Statement, error) {
 }
 
 func (p *Parser) parseStatement() (node.Statement, error) {
-	return p.parseLogicalBinOp()
+	statement, err := p.parseLogicalBinOp()
+	if err != nil {
+		return nil, err
+	}
+
+	// A trailing '&' runs the statement in the background
+	if p.tok.Type == token.Background {
+		statement = &node.BackgroundStatement{Token: *p.tok, Body: statement}
+
+		p.next()
+	}
+
+	return statement, nil
 }
 
 func (p *Parser) parseLogicalBinOp() (node.Statement, error) {
-	left, err := p.parseFactor()
+	left, err := p.parsePipe()
 	if err != nil {
 		return nil, err
 	}
@@ -89,7 +118,12 @@ func (p *Parser) parseLogicalBinOp() (node.Statement, error) {
 		tok := *p.tok // Save the operator token for the operator node
 		p.next()
 
-		right, err := p.parseFactor()
+		// The statement can continue on the next line
+		if p.skipSeparators(); p.tok.Type == token.EOF {
+			return nil, errors.UnexpectedEOF(p.tok)
+		}
+
+		right, err := p.parsePipe()
 		if err != nil {
 			return nil, err
 		}
@@ -104,6 +138,36 @@ func (p *Parser) parseLogicalBinOp() (node.Statement, error) {
 	return left, nil
 }
 
+func (p *Parser) parsePipe() (node.Statement, error) {
+	first, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+
+	// If there are no pipes, just return the parsed node
+	if p.tok.Type != token.Pipe {
+		return first, nil
+	}
+
+	pipe := &node.PipeStatement{Token: *p.tok, Stages: []node.Statement{first}}
+
+	for p.tok.Type == token.Pipe {
+		p.next()
+		if p.skipSeparators(); p.tok.Type == token.EOF {
+			return nil, errors.UnexpectedEOF(p.tok)
+		}
+
+		stage, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+
+		pipe.Stages = append(pipe.Stages, stage)
+	}
+
+	return pipe, nil
+}
+
 func (p *Parser) parseFactor() (node.Statement, error) {
 	switch p.tok.Type {
 	case token.Word, token.BareWord:
@@ -113,8 +177,29 @@ func (p *Parser) parseFactor() (node.Statement, error) {
 			return p.parseCmd()
 		}
 
+	case token.LBrace: return p.parseBlock()
+	case token.If:     return p.parseIf()
+	case token.While:  return p.parseWhile()
+	case token.For:    return p.parseFor()
+
+	case token.Break:    return p.parseBreak()
+	case token.Continue: return p.parseContinue()
+
+	case token.Fn:     return p.parseFn()
+	case token.Return: return p.parseReturn()
+
+	case token.Alias:   return p.parseAlias()
+	case token.Unalias: return p.parseUnalias()
+
+	case token.Complete: return p.parseComplete()
+	case token.History:  return p.parseHistory()
+	case token.Bind:     return p.parseBind()
+
 	case token.Let:    return p.parseLet()
 	case token.Export: return p.parseExport()
+	case token.Set:    return p.parseSet()
+
+	case token.Jobs, token.Fg, token.Bg, token.Wait: return p.parseJob()
 
 	case token.Help: return p.parseHelp()
 	case token.Exit: return p.parseExit()
@@ -139,9 +224,311 @@ func (p *Parser) parseExport() (*node.ExportStatement, error) {
 		return nil, errors.ExpectedToken(p.tok, token.Separator)
 	}
 
+	return export, nil
+}
+
+func (p *Parser) parseBlock() (*node.Block, error) {
+	if p.tok.Type != token.LBrace {
+		return nil, errors.ExpectedToken(p.tok, token.LBrace)
+	}
+
+	b := &node.Block{Token: *p.tok}
+
+	// Parse statements until the closing brace
+	for p.next(); p.tok.Type != token.RBrace; {
+		switch p.tok.Type {
+		case token.EOF: return nil, errors.BlockNotClosed(b.Token.Where)
+
+		case token.Separator:
+			p.next()
+
+			continue
+		}
+
+		statement, err := p.parseStatement()
+		if err != nil {
+			return nil, err
+		}
+
+		b.Body.List = append(b.Body.List, statement)
+	}
+
 	p.next()
 
-	return export, nil
+	return b, nil
+}
+
+func (p *Parser) parseIf() (*node.IfStatement, error) {
+	is := &node.IfStatement{Token: *p.tok}
+
+	var err error
+
+	// The condition is a statement whose exitcode decides which branch is taken
+	p.next()
+	if is.Cond, err = p.parseStatement(); err != nil {
+		return nil, err
+	}
+
+	if is.Body, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+
+	// 'elif' and 'else' are allowed to be on the next lines
+	p.skipSeparatorsBefore(token.Elif, token.Else)
+
+	switch p.tok.Type {
+	// 'elif' is just another if statement in the else branch
+	case token.Elif:
+		if is.Else, err = p.parseIf(); err != nil {
+			return nil, err
+		}
+
+	case token.Else:
+		p.next()
+		if is.Else, err = p.parseBlock(); err != nil {
+			return nil, err
+		}
+	}
+
+	return is, nil
+}
+
+func (p *Parser) parseWhile() (*node.WhileStatement, error) {
+	ws := &node.WhileStatement{Token: *p.tok}
+
+	var err error
+
+	// The body is evaluated for as long as the condition succeeds
+	p.next()
+	if ws.Cond, err = p.parseStatement(); err != nil {
+		return nil, err
+	}
+
+	if ws.Body, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+func (p *Parser) parseFor() (*node.ForStatement, error) {
+	fs := &node.ForStatement{Token: *p.tok}
+
+	// Loop variable identifier
+	if p.next(); !p.tok.IsString() {
+		return nil, errors.ExpectedToken(p.tok, token.Word)
+	} else {
+		fs.Var = p.tok.Data
+	}
+
+	if p.next(); p.tok.Type != token.In {
+		return nil, errors.ExpectedToken(p.tok, token.In)
+	}
+
+	// The words to loop over
+	for p.next(); p.tok.IsArg(); p.next() {
+		word, err := p.parseWord()
+		if err != nil {
+			return nil, err
+		}
+
+		fs.Words = append(fs.Words, word)
+	}
+
+	var err error
+	if fs.Body, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func (p *Parser) parseBreak() (*node.BreakStatement, error) {
+	bs := &node.BreakStatement{Token: *p.tok}
+
+	// 'break' takes no arguments
+	if p.next(); !p.tok.IsArgsEnd() {
+		return nil, errors.ExpectedToken(p.tok, token.Separator)
+	}
+
+	return bs, nil
+}
+
+func (p *Parser) parseContinue() (*node.ContinueStatement, error) {
+	cs := &node.ContinueStatement{Token: *p.tok}
+
+	// 'continue' takes no arguments
+	if p.next(); !p.tok.IsArgsEnd() {
+		return nil, errors.ExpectedToken(p.tok, token.Separator)
+	}
+
+	return cs, nil
+}
+
+func (p *Parser) parseFn() (*node.FnStatement, error) {
+	fs := &node.FnStatement{Token: *p.tok}
+
+	// Function name
+	if p.next(); !p.tok.IsString() {
+		return nil, errors.ExpectedToken(p.tok, token.Word)
+	} else {
+		fs.Name = p.tok.Data
+	}
+
+	p.next()
+
+	var err error
+	if fs.Body, err = p.parseBlock(); err != nil {
+		return nil, err
+	}
+
+	return fs, nil
+}
+
+func (p *Parser) parseReturn() (*node.ReturnStatement, error) {
+	rs := &node.ReturnStatement{Token: *p.tok}
+
+	// Same as with exit, without an exitcode the latest exitcode is returned
+	if p.next(); p.tok.IsArgsEnd() {
+		rs.HasEx = false
+	} else if p.tok.Type == token.Integer {
+		rs.HasEx = true
+
+		ex, err := strconv.Atoi(p.tok.Data)
+		if err != nil {
+			return nil, errors.InvalidExitcode(p.tok)
+		}
+
+		rs.Ex = ex
+
+		p.next()
+	} else {
+		return nil, errors.ExpectedToken(p.tok, token.Integer)
+	}
+
+	// Make sure the statement is ended
+	if !p.tok.IsArgsEnd() {
+		return nil, errors.ExpectedToken(p.tok, token.Separator)
+	}
+
+	return rs, nil
+}
+
+func (p *Parser) parseAlias() (*node.AliasStatement, error) {
+	as := &node.AliasStatement{Token: *p.tok}
+
+	// Without a name, all the aliases are listed
+	if p.next(); p.tok.IsArgsEnd() {
+		return as, nil
+	} else if !p.tok.IsArg() {
+		return nil, errors.ExpectedToken(p.tok, token.Word)
+	}
+
+	as.Name    = p.tok.Data
+	as.HasName = true
+
+	// Without a value, the alias is shown
+	if p.next(); p.tok.IsArgsEnd() {
+		return as, nil
+	} else if p.tok.Type != token.Equals {
+		return nil, errors.ExpectedToken(p.tok, token.Equals)
+	}
+
+	// Alias value
+	if p.next(); !p.tok.IsArg() {
+		return nil, errors.ExpectedToken(p.tok, token.Word)
+	}
+
+	var err error
+	if as.Value, err = p.parseWord(); err != nil {
+		return nil, err
+	}
+
+	as.HasValue = true
+
+	if p.next(); !p.tok.IsArgsEnd() {
+		return nil, errors.ExpectedToken(p.tok, token.Separator)
+	}
+
+	return as, nil
+}
+
+func (p *Parser) parseUnalias() (*node.UnaliasStatement, error) {
+	us := &node.UnaliasStatement{Token: *p.tok}
+
+	for p.next(); !p.tok.IsArgsEnd(); p.next() {
+		if !p.tok.IsArg() {
+			return nil, errors.UnexpectedToken(p.tok)
+		}
+
+		name, err := p.parseWord()
+		if err != nil {
+			return nil, err
+		}
+
+		us.Names = append(us.Names, name)
+	}
+
+	if len(us.Names) == 0 {
+		return nil, errors.ExpectedToken(p.tok, token.Word)
+	}
+
+	return us, nil
+}
+
+func (p *Parser) parseComplete() (*node.CompleteStatement, error) {
+	cs := &node.CompleteStatement{Token: *p.tok}
+
+	var err error
+	if cs.Args, cs.Redirects, err = p.parseArgs(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+func (p *Parser) parseHistory() (*node.HistoryStatement, error) {
+	hs := &node.HistoryStatement{Token: *p.tok}
+
+	var err error
+	if hs.Args, hs.Redirects, err = p.parseArgs(); err != nil {
+		return nil, err
+	}
+
+	return hs, nil
+}
+
+func (p *Parser) parseBind() (*node.BindStatement, error) {
+	bs := &node.BindStatement{Token: *p.tok}
+
+	var err error
+	if bs.Args, bs.Redirects, err = p.parseArgs(); err != nil {
+		return nil, err
+	}
+
+	return bs, nil
+}
+
+func (p *Parser) parseSet() (*node.SetStatement, error) {
+	set := &node.SetStatement{Token: *p.tok}
+
+	var err error
+	if set.Args, set.Redirects, err = p.parseArgs(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+func (p *Parser) parseJob() (*node.JobStatement, error) {
+	js := &node.JobStatement{Token: *p.tok}
+
+	var err error
+	if js.Args, js.Redirects, err = p.parseArgs(); err != nil {
+		return nil, err
+	}
+
+	return js, nil
 }
 
 func (p *Parser) parseLet() (*node.LetStatement, error) {
@@ -159,18 +546,19 @@ func (p *Parser) parseLet() (*node.LetStatement, error) {
 	}
 
 	// Variable value
-	if p.next(); !p.tok.IsString() {
+	if p.next(); !p.tok.IsArg() {
 		return nil, errors.ExpectedToken(p.tok, token.Word)
-	} else {
-		let.Value = p.tok.Data
+	}
+
+	var err error
+	if let.Value, err = p.parseWord(); err != nil {
+		return nil, err
 	}
 
 	if p.next(); !p.tok.IsArgsEnd() {
 		return nil, errors.ExpectedToken(p.tok, token.Separator)
 	}
 
-	p.next()
-
 	return let, nil
 }
 
@@ -182,38 +570,128 @@ func (p *Parser) parseAssign() (*node.AssignStatement, error) {
 	}
 
 	// New variable value
-	if p.next(); !p.tok.IsString() {
+	if p.next(); !p.tok.IsArg() {
 		return nil, errors.ExpectedToken(p.tok, token.Word)
-	} else {
-		as.Value = p.tok.Data
+	}
+
+	var err error
+	if as.Value, err = p.parseWord(); err != nil {
+		return nil, err
 	}
 
 	if p.next(); !p.tok.IsArgsEnd() {
 		return nil, errors.ExpectedToken(p.tok, token.Separator)
 	}
 
-	p.next()
-
 	return as, nil
 }
 
 func (p *Parser) parseCmd() (*node.CmdStatement, error) {
-	cs := &node.CmdStatement{Token: *p.tok, Cmd: p.tok.Data}
+	cs := &node.CmdStatement{Token: *p.tok}
+
+	var err error
+	if cs.Cmd, err = p.parseWord(); err != nil {
+		return nil, err
+	}
 
 	// Get the command arguments
+	if cs.Args, cs.Redirects, err = p.parseArgs(); err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// Parses arguments and redirections until the end of the arguments
+func (p *Parser) parseArgs() (args []node.Word, redirects []node.Redirect, err error) {
 	for p.next(); !p.tok.IsArgsEnd(); p.next() {
-		var arg string
+		if p.tok.IsRedirect() {
+			var r node.Redirect
+			if r, err = p.parseRedirect(); err != nil {
+				return
+			}
+
+			redirects = append(redirects, r)
+		} else if p.tok.IsArg() || p.tok.Type == token.Equals { // '=' is allowed for commands
+			var arg node.Word                                        // like 'test'
+			if arg, err = p.parseWord(); err != nil {
+				return
+			}
+
+			args = append(args, arg)
+		} else {
+			err = errors.UnexpectedToken(p.tok)
+
+			return
+		}
+	}
+
+	return
+}
+
+func (p *Parser) parseRedirect() (node.Redirect, error) {
+	r := node.Redirect{Token: *p.tok}
 
-		if p.tok.IsArg() {
-			arg = p.tok.Data
+	// The redirected file descriptor is written before the operator, '&>' redirects both stdout
+	// and stderr
+	op := strings.IndexAny(p.tok.Data, "<>")
+	if op == 0 || p.tok.Type == token.RedirectAll {
+		if p.tok.Type == token.RedirectIn {
+			r.Fd = 0
 		} else {
-			return nil, errors.UnexpectedToken(p.tok)
+			r.Fd = 1
+		}
+	} else {
+		fd, err := strconv.Atoi(p.tok.Data[:op])
+		if err != nil {
+			return r, errors.InvalidFd(p.tok)
 		}
 
-		cs.Args = append(cs.Args, arg)
+		r.Fd = fd
 	}
 
-	return cs, nil
+	switch p.tok.Type {
+	// Duplications have the target file descriptor written after the operator
+	case token.RedirectDup:
+		fd, err := strconv.Atoi(p.tok.Data[op + 2:])
+		if err != nil {
+			return r, errors.InvalidFd(p.tok)
+		}
+
+		r.DupFd = fd
+
+	default:
+		if p.next(); !p.tok.IsArg() {
+			return r, errors.ExpectedToken(p.tok, token.Word)
+		}
+
+		var err error
+		if r.Target, err = p.parseWord(); err != nil {
+			return r, err
+		}
+	}
+
+	return r, nil
+}
+
+// Creates a word node out of the current token, parsing its command substitutions
+func (p *Parser) parseWord() (node.Word, error) {
+	word := node.Word{Token: *p.tok}
+
+	for _, part := range p.tok.Parts {
+		if part.Type != token.PartSubst {
+			continue
+		}
+
+		program, err := NewFromTokens(part.Toks).Parse()
+		if err != nil {
+			return word, err
+		}
+
+		word.Substs = append(word.Substs, program)
+	}
+
+	return word, nil
 }
 
 func (p *Parser) parseHelp() (*node.HelpStatement, error) {
@@ -224,8 +702,6 @@ func (p *Parser) parseHelp() (*node.HelpStatement, error) {
 		return nil, errors.ExpectedToken(p.tok, token.Separator)
 	}
 
-	p.next()
-
 	return hs, nil
 }
 
@@ -258,21 +734,16 @@ func (p *Parser) parseExit() (*node.ExitStatement, error) {
 		return nil, errors.ExpectedToken(p.tok, token.Separator)
 	}
 
-	p.next()
-
 	return es, nil
 }
 
 func (p *Parser) parseEcho() (*node.EchoStatement, error) {
 	echo := &node.EchoStatement{Token: *p.tok}
 
-	// Append all the arguments to a string
-	for p.next(); !p.tok.IsArgsEnd(); p.next() {
-		if p.tok.IsArg() {
-			echo.Msg += p.tok.Data + " "
-		} else {
-			return nil, errors.UnexpectedToken(p.tok)
-		}
+	// Save all the arguments, they are expanded and joined when evaluated
+	var err error
+	if echo.Args, echo.Redirects, err = p.parseArgs(); err != nil {
+		return nil, err
 	}
 
 	return echo, nil
@@ -283,9 +754,14 @@ func (p *Parser) parseCd() (*node.CdStatement, error) {
 
 	// If no path is specified, we change the directory to the home directory
 	if p.next(); p.tok.IsArgsEnd() {
-		cd.Path = "~/"
+		cd.HasPath = false
 	} else if p.tok.IsString() {
-		cd.Path = p.tok.Data
+		cd.HasPath = true
+
+		var err error
+		if cd.Path, err = p.parseWord(); err != nil {
+			return nil, err
+		}
 
 		p.next()
 	} else {
@@ -303,6 +779,31 @@ func (p *Parser) next() {
 	}
 }
 
+// Skips all the separators
+func (p *Parser) skipSeparators() {
+	for p.tok.Type == token.Separator {
+		p.next()
+	}
+}
+
+// Skips separators only if they are followed by a token of one of the types
+func (p *Parser) skipSeparatorsBefore(types... token.Type) {
+	idx := p.idx
+
+	for p.tok.Type == token.Separator {
+		p.next()
+	}
+
+	for _, type_ := range types {
+		if p.tok.Type == type_ {
+			return
+		}
+	}
+
+	p.idx = idx
+	p.tok = &p.Toks[idx]
+}
+
 func (p *Parser) peekTok() token.Token {
 	if p.tok.Type == token.EOF {
 		return *p.tok
@@ -1,6 +1,12 @@
 package repl
 
 import (
+	"fmt"
+	"os"
+	"syscall"
+	"strconv"
+	"time"
+
 	"github.com/LordOfTrident/snash/pkg/term"
 	"github.com/LordOfTrident/snash/pkg/prompt"
 
@@ -8,25 +14,61 @@ import (
 	"github.com/LordOfTrident/snash/internal/env"
 	"github.com/LordOfTrident/snash/internal/config"
 	"github.com/LordOfTrident/snash/internal/evaluator"
+	"github.com/LordOfTrident/snash/internal/parser"
 	"github.com/LordOfTrident/snash/internal/highlighter"
+	"github.com/LordOfTrident/snash/internal/completer"
+	"github.com/LordOfTrident/snash/internal/history"
 )
 
 func REPL(env *env.Env) int {
-	term.OnCtrlC(func() {})
+	// Interrupts go to the foreground job, without one Ctrl+C drops the input
+	term.OnCtrlC(func() {
+		if !env.Jobs.Interrupt(syscall.SIGINT) {
+			term.Interrupt()
+		}
+	})
+
+	term.OnQuit(func() {
+		env.Jobs.Interrupt(syscall.SIGQUIT)
+	})
 	term.SendResizeEvents()
 
-	history, _ := prompt.LoadHistory(config.HistoryPath)
+	// Job control needs a terminal, without one the jobs simply share the process group
+	if *config.Interactive {
+		env.Jobs.EnableControl()
+	}
+
+	env.History.MaxSize = historySize(env)
+	if err := env.History.Load(config.HistoryPath); err != nil {
+		highlighter.PrintError("Could not load history file %v", utils.Quote(config.HistoryPath))
+	}
 
 	h := highlighter.New(env)
-	p := prompt.New(history, h)
+	c := completer.New(env)
+	p := prompt.New(prompt.NewHistory(), h, c)
 
 	p.Flags.Interactive        = *config.Interactive
 	p.Flags.ShowPossibleErrors = *config.ShowPossibleErrors
 	p.Flags.SyntaxHighlighting = *config.SyntaxHighlighting
 
+	p.NeedsMore = parser.NeedsMore
+	p.RunCmd    = func(cmd string) {
+		if err := evaluator.Eval(env, cmd, "bind"); err != nil {
+			highlighter.PrintError("%v", err)
+		}
+	}
+
 	for {
 		env.Update()
 
+		// Report the background jobs which finished or stopped
+		for _, msg := range env.Jobs.Notifications() {
+			fmt.Fprintln(os.Stderr, msg)
+		}
+
+		// The history builtin might have changed the entries
+		p.History = prompt.NewHistory(env.History.Cmds()...)
+
 		// Generate a prompt
 		var prompt string
 		if env.Ex == 0 {
@@ -35,11 +77,37 @@ func REPL(env *env.Env) int {
 			prompt = env.GenPrompt(env.Scopes[0].Get("PROMPT_ERROR"))
 		}
 
+		p.Continuation = env.GenPrompt(env.Scopes[0].Get("PROMPT_CONT"))
+
+		p.Flags.Vi = env.Flags.Vi
+		p.Bindings = env.Bindings
+		if editor, ok := env.GetVar("EDITOR"); ok {
+			p.Editor = editor
+		}
+
+		// An interrupt while evaluating the previous input must not drop the new one
+		term.ClearInterrupt()
+
 		in := p.Input(prompt)
 
+		cwd   := env.Dir
+		start := time.Now()
+
 		err := evaluator.Eval(env, in, "stdin")
 		if err != nil {
-			highlighter.PrintError(err.Error())
+			highlighter.PrintError("%v", err)
+		}
+
+		env.History.MaxSize = historySize(env)
+		err = env.History.Add(history.Entry{
+			Cmd:      in,
+			Time:     start.Unix(),
+			Duration: time.Since(start).Seconds(),
+			Cwd:      cwd,
+			Ex:       env.Ex,
+		})
+		if err != nil {
+			highlighter.PrintError("Could not save history file %v", utils.Quote(config.HistoryPath))
 		}
 
 		// Exit the repl if last exit was forced
@@ -48,9 +116,17 @@ func REPL(env *env.Env) int {
 		}
 	}
 
-	if err := p.History.SaveToFile(config.HistoryPath); err != nil {
-		highlighter.PrintError("Could not save history file %v", utils.Quote(config.HistoryPath))
+	return env.Ex
+}
+
+// $HISTORY_SIZE is the maximum count of history entries, 0 means no limit
+func historySize(env *env.Env) int {
+	value, _ := env.GetVar("HISTORY_SIZE")
+
+	size, err := strconv.Atoi(value)
+	if err != nil || size < 0 {
+		return 0
 	}
 
-	return env.Ex
+	return size
 }
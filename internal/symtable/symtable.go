@@ -1,56 +1,97 @@
 package symtable
 
-// TODO: Use interfaces to allow variables AND functions in symbol tables,
-//       function bodies are gonna be just nodes
+import "github.com/LordOfTrident/snash/internal/node"
 
-type Entry struct {
+// Symbol tables hold variables and functions, each in their own map so a variable and a function
+// can have the same name
+
+type Var struct {
 	Value  string
 	Export bool
 }
 
-func NewEntry(value string, export bool) Entry {
-	return Entry{Value: value, Export: export}
+func NewVar(value string, export bool) Var {
+	return Var{Value: value, Export: export}
+}
+
+type Func struct {
+	Body *node.Block
+}
+
+func NewFunc(body *node.Block) Func {
+	return Func{Body: body}
 }
 
 type Scope struct {
-	SymTable map[string]Entry
+	SymTable map[string]Var
+	Funcs    map[string]Func
 	Level    int
 }
 
 func NewScope(level int) Scope {
-	return Scope{SymTable: make(map[string]Entry), Level: level}
+	return Scope{SymTable: make(map[string]Var), Funcs: make(map[string]Func), Level: level}
+}
+
+func (s *Scope) Copy() Scope {
+	copy := NewScope(s.Level)
+	for name, v := range s.SymTable {
+		copy.SymTable[name] = v
+	}
+
+	for name, f := range s.Funcs {
+		copy.Funcs[name] = f
+	}
+
+	return copy
 }
 
 func (s *Scope) Create(name, value string, export bool) {
-	s.SymTable[name] = NewEntry(value, export)
+	s.SymTable[name] = NewVar(value, export)
+}
+
+func (s *Scope) CreateFunc(name string, body *node.Block) {
+	s.Funcs[name] = NewFunc(body)
 }
 
 func (s *Scope) Export(name string, export bool) {
-	if entry, ok := s.SymTable[name]; ok {
-		entry.Export = export;
+	if v, ok := s.SymTable[name]; ok {
+		v.Export = export;
 
-		s.SymTable[name] = entry
+		s.SymTable[name] = v
 	}
 }
 
 func (s *Scope) Set(name, value string) {
-	if entry, ok := s.SymTable[name]; ok {
-		entry.Value = value;
+	if v, ok := s.SymTable[name]; ok {
+		v.Value = value;
 
-		s.SymTable[name] = entry
+		s.SymTable[name] = v
 	}
 }
 
+// Does a variable exist?
 func (s *Scope) Exists(name string) bool {
 	_, ok := s.SymTable[name]
 
 	return ok
 }
 
+// Does a function exist?
+func (s *Scope) FuncExists(name string) bool {
+	_, ok := s.Funcs[name]
+
+	return ok
+}
+
 func (s *Scope) Get(name string) string {
 	return s.SymTable[name].Value
 }
 
+func (s *Scope) GetFunc(name string) Func {
+	return s.Funcs[name]
+}
+
+// Removes a variable
 func (s *Scope) Unset(name string) {
 	delete(s.SymTable, name)
 }
@@ -33,17 +33,54 @@ const (
 
 	Let
 	Export
+	Set
+
+	If
+	Elif
+	Else
+
+	While
+	For
+	In
+	Break
+	Continue
+
+	Fn
+	Return
+
+	Alias
+	Unalias
+	Complete
+	History
+	Bind
+
+	Jobs
+	Fg
+	Bg
+	Wait
 
 	And
 	Or
+	Pipe
+	Background
 	Equals
 
+	Redirect
+	RedirectAppend
+	RedirectIn
+	RedirectDup
+	RedirectAll
+
+	LBrace
+	RBrace
+	RParen
+
 	Error
 	count // Count of all token types
 )
 
 func (type_ Type) String() string {
-	if count != 15 {
+	if count != 45 {
 		panic("Cover all token types")
 	}
 
@@ -62,10 +99,48 @@ func (type_ Type) String() string {
 
 	case Let:    return "keyword let"
 	case Export: return "keyword export"
+	case Set:    return "keyword set"
+
+	case If:   return "keyword if"
+	case Elif: return "keyword elif"
+	case Else: return "keyword else"
+
+	case While:    return "keyword while"
+	case For:      return "keyword for"
+	case In:       return "keyword in"
+	case Break:    return "keyword break"
+	case Continue: return "keyword continue"
+
+	case Fn:     return "keyword fn"
+	case Return: return "keyword return"
 
-	case And:    return "&&"
-	case Or:     return "||"
-	case Equals: return "="
+	case Alias:   return "keyword alias"
+	case Unalias: return "keyword unalias"
+
+	case Complete: return "keyword complete"
+	case History:  return "keyword history"
+	case Bind:     return "keyword bind"
+
+	case Jobs: return "keyword jobs"
+	case Fg:   return "keyword fg"
+	case Bg:   return "keyword bg"
+	case Wait: return "keyword wait"
+
+	case And:        return "&&"
+	case Or:         return "||"
+	case Pipe:       return "|"
+	case Background: return "&"
+	case Equals:     return "="
+
+	case Redirect:       return ">"
+	case RedirectAppend: return ">>"
+	case RedirectIn:     return "<"
+	case RedirectDup:    return ">&"
+	case RedirectAll:    return "&>"
+
+	case LBrace: return "{"
+	case RBrace: return "}"
+	case RParen: return ")"
 
 	case Error: return "error"
 
@@ -73,11 +148,33 @@ func (type_ Type) String() string {
 	}
 }
 
+// Parts of a word, used to expand variables at evaluation time
+
+type PartType int
+const (
+	PartText PartType = iota
+	PartVar
+	PartSubst
+)
+
+type Part struct {
+	Type PartType
+	Data string // Literal text, the variable name or the command substitution source
+
+	Quoted bool // The text was inside apostrophes, so it is never expanded
+
+	Toks []Token // Tokens of a command substitution
+
+	Where Where
+}
+
 type Token struct {
 	Type   Type
 	Data   string
 	TxtLen int
 
+	Parts []Part // Only words have parts
+
 	Where Where
 }
 
@@ -97,7 +194,7 @@ func (tok Token) String() string {
 	switch tok.Type {
 	case Separator: return "separator (';' or new line)"
 	case EOF:       return "end of file"
-	case Equals, And, Or: return utils.Quote(tok.Type.String())
+	case Equals, And, Or, Pipe, Background, LBrace, RBrace, RParen: return utils.Quote(tok.Type.String())
 
 	default: return fmt.Sprintf("%v of type %v",
 	                            utils.Quote(tok.Data), utils.Quote(tok.Type.String()))
@@ -107,29 +204,54 @@ func (tok Token) String() string {
 func (tok Token) IsKeyword() bool {
 	switch tok.Type {
 	case Exit, Echo, Cd, Help,
-	     Let,  Export: return true
+	     Let,  Export, Set,
+	     If,   Elif,   Else,
+	     While, For, In, Break, Continue,
+	     Fn,   Return, Alias, Unalias, Complete, History, Bind,
+	     Jobs, Fg,     Bg,    Wait: return true
 
 	default: return false
 	}
 }
 
 func (tok Token) IsStatementEnd() bool {
-	return tok.Type == Separator || tok.Type == EOF
+	return tok.Type == Separator || tok.Type == EOF || tok.Type == Background
 }
 
 func (tok Token) IsBinOp() bool {
 	return tok.Type == And || tok.Type == Or
 }
 
+func (tok Token) IsBrace() bool {
+	return tok.Type == LBrace || tok.Type == RBrace
+}
+
 func (tok Token) IsArgsEnd() bool {
-	return tok.IsBinOp() || tok.IsStatementEnd()
+	return tok.IsBinOp() || tok.IsStatementEnd() || tok.IsBrace() || tok.Type == Pipe
+}
+
+// Is a statement expected after the token?
+func (tok Token) ExpectsStatement() bool {
+	switch tok.Type {
+	case If, Elif, While: return true
+
+	default: return tok.IsArgsEnd()
+	}
+}
+
+func (tok Token) IsRedirect() bool {
+	switch tok.Type {
+	case Redirect, RedirectAppend, RedirectIn, RedirectDup, RedirectAll: return true
+
+	default: return false
+	}
 }
 
 func (tok Token) IsOp() bool {
 	switch tok.Type {
-	case Equals: return true
+	case Equals, Pipe, Background: return true
 
-	default: return tok.IsBinOp()
+	default: return tok.IsBinOp() || tok.IsRedirect()
 	}
 }
 
@@ -141,6 +263,7 @@ func (tok Token) IsArg() bool {
 	switch tok.Type {
 	case Word, BareWord, Integer: return true
 
-	default: return false
+	// Keywords are just strings when used as arguments
+	default: return tok.IsKeyword()
 	}
 }
@@ -0,0 +1,127 @@
+package prompt
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/LordOfTrident/snash/pkg/term"
+)
+
+// Keys which are not sent by the terminal, used for the actions without a default key
+const (
+	keyEditor = term.KeyCustom + iota // Edit the input in the editor
+	keyInsertLastArg
+	keyRunCmd
+)
+
+// A key bound either to an editing action or to a command
+type Binding struct {
+	Action string
+	Cmd    string
+}
+
+// Editing actions which can be bound, by the keys which do them
+var actions = map[string]term.Key{
+	"accept-line":  term.KeyEnter,
+	"complete":     term.KeyTab,
+	"clear-screen": term.Ctrl(term.Key('l')),
+
+	"backward-char":     term.KeyArrowLeft,
+	"forward-char":      term.KeyArrowRight,
+	"backward-word":     term.Alt(term.Key('b')),
+	"forward-word":      term.Alt(term.Key('f')),
+	"beginning-of-line": term.KeyHome,
+	"end-of-line":       term.KeyEnd,
+
+	"previous-history":       term.KeyArrowUp,
+	"next-history":           term.KeyArrowDown,
+	"reverse-search-history": term.Ctrl(term.Key('r')),
+	"forward-search-history": term.Ctrl(term.Key('s')),
+	"insert-last-arg":        keyInsertLastArg,
+
+	"backward-delete-char": term.KeyBackspace,
+	"delete-char":          term.KeyDelete,
+	"transpose-chars":      term.Ctrl(term.Key('t')),
+	"undo":                 term.Ctrl(term.Key('_')),
+
+	"kill-line":         term.Ctrl(term.Key('k')),
+	"unix-line-discard": term.Ctrl(term.Key('u')),
+	"unix-word-rubout":  term.Ctrl(term.Key('w')),
+	"kill-word":         term.Alt(term.Key('d')),
+	"yank":              term.Ctrl(term.Key('y')),
+	"yank-pop":          term.Alt(term.Key('y')),
+
+	"edit-in-editor": keyEditor,
+}
+
+// Names of all the actions which can be bound
+func Actions() (names []string) {
+	for name := range actions {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return
+}
+
+func IsAction(name string) bool {
+	_, ok := actions[name]
+
+	return ok
+}
+
+// Returns the key which does the bound action, or keyRunCmd with the command to run
+func (p *Prompt) boundKey(key term.Key) (term.Key, string) {
+	binding, ok := p.Bindings[key]
+	if !ok {
+		return key, ""
+	} else if len(binding.Cmd) > 0 {
+		return keyRunCmd, binding.Cmd
+	}
+
+	return actions[binding.Action], ""
+}
+
+// Inserts the last argument of the previous history entry, repeating it replaces the argument
+// with the one of the entry before
+func (p *Prompt) insertLastArg() {
+	from := len(p.History.list) - 2
+	if p.prevAction == actionLastArg {
+		*p.line = (*p.line)[:p.curx - p.lastArgLen] + (*p.line)[p.curx:]
+		p.curx -= p.lastArgLen
+
+		from = p.lastArgIdx - 1
+	}
+
+	for i := from; i >= 0; i -- {
+		arg := lastField(p.History.list[i])
+		if len(arg) == 0 {
+			continue
+		}
+
+		p.insertStringAtCursor(arg)
+
+		p.lastArgIdx = i
+		p.lastArgLen = len(arg)
+		p.action     = actionLastArg
+
+		return
+	}
+
+	// Nothing older, keep the last inserted argument
+	if p.prevAction == actionLastArg {
+		p.insertStringAtCursor(lastField(p.History.list[p.lastArgIdx]))
+
+		p.action = actionLastArg
+	}
+}
+
+func lastField(str string) string {
+	fields := strings.Fields(str)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return fields[len(fields) - 1]
+}
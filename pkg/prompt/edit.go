@@ -0,0 +1,186 @@
+package prompt
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Kind of the last edit, consecutive kills are joined and consecutive typing is undone at once
+type action int
+const (
+	actionNone = action(iota)
+	actionInsert
+	actionKill
+	actionYank
+	actionUndo
+	actionLastArg
+)
+
+const (
+	killRingSize = 16
+	undoMax      = 64
+)
+
+type snapshot struct {
+	lines      []string
+	curx, cury int
+}
+
+func (p *Prompt) snapshot() snapshot {
+	return snapshot{lines: append([]string{}, p.lines...), curx: p.curx, cury: p.cury}
+}
+
+func (p *Prompt) restore(s snapshot) {
+	p.lines = s.lines
+	p.setLine(s.cury)
+
+	p.curx = s.curx
+}
+
+// Saves the input before it was edited, so the edit can be undone
+func (p *Prompt) saveUndo(before snapshot) {
+	if strings.Join(before.lines, "\n") == strings.Join(p.lines, "\n") {
+		return
+	} else if p.action == actionInsert && p.prevAction == actionInsert {
+		return
+	}
+
+	p.undos = append(p.undos, before)
+	if len(p.undos) > undoMax {
+		p.undos = p.undos[1:]
+	}
+}
+
+func (p *Prompt) undo() {
+	if len(p.undos) == 0 {
+		return
+	}
+
+	p.restore(p.undos[len(p.undos) - 1])
+	p.undos = p.undos[:len(p.undos) - 1]
+
+	p.action = actionUndo
+}
+
+// Removes a part of the line and puts it into the kill ring
+func (p *Prompt) kill(start, end int) {
+	text := (*p.line)[start:end]
+	if len(text) == 0 {
+		return
+	}
+
+	// Text killed before the cursor goes before the previously killed text
+	backward := start < p.curx
+
+	*p.line = (*p.line)[:start] + (*p.line)[end:]
+	p.curx  = start
+
+	// Consecutive kills are joined, so they can be yanked back at once
+	if p.prevAction == actionKill && len(p.killRing) > 0 {
+		last := &p.killRing[len(p.killRing) - 1]
+		if backward {
+			*last = text + *last
+		} else {
+			*last += text
+		}
+	} else {
+		p.killRing = append(p.killRing, text)
+		if len(p.killRing) > killRingSize {
+			p.killRing = p.killRing[1:]
+		}
+	}
+
+	p.action = actionKill
+}
+
+func (p *Prompt) killToLineEnd() {
+	p.kill(p.curx, len(*p.line))
+}
+
+func (p *Prompt) killToLineStart() {
+	p.kill(0, p.curx)
+}
+
+// Kills the word before the cursor, words are separated by spaces
+func (p *Prompt) killPrevWord() {
+	start := p.curx
+	char, size := utf8.DecodeLastRuneInString((*p.line)[:start])
+	for start > 0 && unicode.IsSpace(char) {
+		start     -= size
+		char, size = utf8.DecodeLastRuneInString((*p.line)[:start])
+	}
+
+	for start > 0 && !unicode.IsSpace(char) {
+		start     -= size
+		char, size = utf8.DecodeLastRuneInString((*p.line)[:start])
+	}
+
+	p.kill(start, p.curx)
+}
+
+func (p *Prompt) killNextWord() {
+	p.kill(p.curx, p.curx + firstWordLen((*p.line)[p.curx:]))
+}
+
+// Inserts the last killed text
+func (p *Prompt) yank() {
+	if len(p.killRing) == 0 {
+		return
+	}
+
+	p.yankIdx = len(p.killRing) - 1
+	p.insertStringAtCursor(p.killRing[p.yankIdx])
+
+	p.action = actionYank
+}
+
+// Replaces the text which was just yanked with the previous entry of the kill ring
+func (p *Prompt) yankPop() {
+	if p.prevAction != actionYank || len(p.killRing) == 0 {
+		return
+	}
+
+	yanked := p.killRing[p.yankIdx]
+
+	*p.line = (*p.line)[:p.curx - len(yanked)] + (*p.line)[p.curx:]
+	p.curx -= len(yanked)
+
+	p.yankIdx --
+	if p.yankIdx < 0 {
+		p.yankIdx = len(p.killRing) - 1
+	}
+
+	p.insertStringAtCursor(p.killRing[p.yankIdx])
+
+	p.action = actionYank
+}
+
+// Swaps the characters around the cursor, or the last two characters at the end of the line
+func (p *Prompt) transpose() {
+	// There have to be two characters to swap
+	line := *p.line
+	if p.curx == 0 || nextChar(line, 0) == len(line) {
+		return
+	}
+
+	if p.curx == len(line) {
+		p.moveCursorLeft()
+	}
+
+	start, end := prevChar(line, p.curx), nextChar(line, p.curx)
+
+	*p.line = line[:start] + line[p.curx:end] + line[start:p.curx] + line[end:]
+	p.curx  = end
+}
+
+// Deletes the character under the cursor, at the end of a line the next line is joined to it
+func (p *Prompt) deleteCharAtCursor() {
+	if p.curx < len(*p.line) {
+		p.moveCursorRight()
+		p.eraseCharAtCursor()
+	} else if p.cury < len(p.lines) - 1 {
+		p.setLine(p.cury + 1)
+		p.joinLine()
+	}
+}
@@ -2,106 +2,151 @@ package prompt
 
 import (
 	"fmt"
-	"os"
-	"bufio"
 	"strings"
 	"unicode"
-	"math"
+	"unicode/utf8"
 
 	"github.com/LordOfTrident/snash/pkg/term"
 )
 
-// TODO: Multi-line prompt mode, which is gonna be like a text editor field inside the
-//       command line
-
 // TODO: Optimize the prompt rendering by making an output buffer system
 
 type Highlighter interface {
 	Highlight(code, path string) (string, error)
 }
 
+type Completer interface {
+	// Returns the candidates to replace the word which starts at the returned index and ends at
+	// the cursor
+	Complete(line string, cursor int) (candidates []string, start int)
+}
+
 type History struct {
 	list []string
 	idx  int
+
+	prefix   string // Only the entries starting with the prefix are shown
+	original string // The typed input, shown again at the end of the history
 }
 
-func NewHistory() History {
+// The entries are ordered from the oldest to the newest
+func NewHistory(entries... string) History {
 	var h History
 	h.list = append(h.list, "")
 
+	for _, entry := range entries {
+		h.Add(entry)
+	}
+
+	h.ToEnd()
+
 	return h
 }
 
-func LoadHistory(path string) (History, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return NewHistory(), err
+func (h *History) Add(code string) {
+	if len(code) > 0 {
+		// Save input to history
+		h.list[len(h.list) - 1] = code
+		h.list = append(h.list, "")
 	}
-	defer f.Close()
 
-	h := NewHistory()
+	return
+}
 
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		h.Add(scanner.Text())
+// Called with the typed input before moving through the history, when at the end of the history
+// the input becomes the prefix which filters the entries
+func (h *History) Start(input string) {
+	if h.idx == len(h.list) - 1 {
+		h.prefix   = input
+		h.original = input
 	}
-
-	return h, nil
 }
 
-func (h *History) SaveToFile(path string) error {
-	// Open history file for appending
-	f, err := os.Create(path)
-	if err != nil {
-		return err
+func (h *History) current() string {
+	if h.idx == len(h.list) - 1 {
+		return h.original
 	}
-	defer f.Close()
 
-	for _, v := range h.list {
-		// Dont write the last empty line to the history, or any empty lines
-		if len(v) == 0 {
-			continue
-		}
+	return h.list[h.idx]
+}
 
-		f.WriteString(v + "\n")
+// Is the entry shown when moving through the history? Entries equal to the current one are
+// skipped so duplicates are not shown multiple times
+func (h *History) matches(i int) bool {
+	return strings.HasPrefix(h.list[i], h.prefix) && h.list[i] != h.current()
+}
+
+func (h *History) Up() string {
+	for i := h.idx - 1; i >= 0; i -- {
+		if h.matches(i) {
+			h.idx = i
+
+			break
+		}
 	}
 
-	return nil
+	return h.current()
 }
 
-func (h *History) Add(code string) {
-	if len(code) > 0 {
-		// Save input to history
-		h.list[len(h.list) - 1] = code
-		h.list = append(h.list, "")
+func (h *History) Down() string {
+	for i := h.idx + 1; i < len(h.list) - 1; i ++ {
+		if h.matches(i) {
+			h.idx = i
+
+			return h.current()
+		}
 	}
 
-	return
+	return h.ToEnd()
 }
 
-func (h *History) Up() string {
-	if h.idx > 0 {
-		h.idx --
-	}
+// Moves to the end of the history and returns the originally typed input
+func (h *History) ToEnd() string {
+	h.idx    = len(h.list) - 1
+	h.prefix = ""
 
-	return h.list[h.idx]
+	return h.original
 }
 
-func (h *History) Down() string {
-	if h.idx < len(h.list) - 1 {
-		h.idx ++
+// Finds the closest entry containing the query, starting at the index and going backwards or
+// forwards. Returns -1 if there is none
+func (h *History) Find(query string, from int, backward bool) int {
+	step := 1
+	if backward {
+		step = -1
 	}
 
-	return h.list[h.idx]
+	// The last entry is the current input, which is not searched
+	for i := from; i >= 0 && i < len(h.list) - 1; i += step {
+		if strings.Contains(h.list[i], query) {
+			return i
+		}
+	}
+
+	return -1
 }
 
-func (h *History) ToEnd() {
-	h.idx = len(h.list) - 1
+// Returns the rest of the newest entry starting with the input, or an empty string if there is
+// none. Entries which would continue on more lines are not suggested
+func (h *History) Suggest(input string) string {
+	for i := len(h.list) - 2; i >= 0; i -- {
+		if !strings.HasPrefix(h.list[i], input) {
+			continue
+		}
+
+		if rest := h.list[i][len(input):]; len(rest) > 0 && !strings.Contains(rest, "\n") {
+			return rest
+		}
+	}
+
+	return ""
 }
 
 func (p *Prompt) SetInput(input string) {
-	*p.line = input
-	p.curx  = len(*p.line)
+	p.lines = strings.Split(input, "\n")
+	p.setLine(len(p.lines) - 1)
+
+	p.curx = len(*p.line)
 }
 
 type Prompt struct {
@@ -109,27 +154,85 @@ type Prompt struct {
 
 	Flags struct {
 		Interactive, ShowPossibleErrors, SyntaxHighlighting bool
+
+		Vi bool // Vi editing mode
 	}
 
 	Colors struct {
-		Error string
+		Error      string
+		Match      string // History search match
+		Suggestion string // Rest of a history entry suggested after the cursor
 	}
 
+	Continuation string // Prompt shown before the following lines of a multi-line input
+
+	// Shown in place of the mode marker in the prompt
+	ModeNames struct {
+		Insert, Normal string
+	}
+
+	Editor string // Command to edit the input with in the vi mode
+
+	Bindings map[term.Key]Binding
+	RunCmd   func(cmd string) // Runs the commands of the bindings
+
+	// Decides if the input is incomplete, so Enter starts a new line instead of submitting
+	NeedsMore func(input string) bool
+
 	lines []string
 	line   *string
 	curx    int
+	cury    int
 
 	prevMode string // Previous terminal stty mode
 
+	search *historySearch // Incremental history search, nil if not searching
+
+	// Completion menu
+	menu      []string
+	menuSel   int // Selected candidate, -1 if none yet
+	menuStart int // Start of the word being completed
+
+	killRing []string // Killed text which can be yanked back, the newest is last
+	yankIdx  int      // Kill ring entry which was yanked last
+
+	undos []snapshot // Input before each edit
+
+	action, prevAction action // Kinds of the current and the previous edit
+
+	vi viState
+
+	lastArgIdx int // History entry of the last argument inserted
+	lastArgLen int
+
 	highlighter Highlighter
+	completer   Completer
+}
+
+type historySearch struct {
+	query    string
+	idx      int // Index of the matching history entry
+	match    int // Index of the match in the input
+	backward bool
+	failed   bool
+
+	original string // Input before the search, restored when it is canceled
 }
 
-func New(h History, highlighter Highlighter) *Prompt {
-	p := &Prompt{History: h, highlighter: highlighter}
+func New(h History, highlighter Highlighter, completer Completer) *Prompt {
+	p := &Prompt{History: h, highlighter: highlighter, completer: completer}
 	p.clear()
 
 	// Default config
 	p.Colors.Error = term.AttrGrey
+	p.Colors.Match = term.AttrUnderline + term.AttrBrightYellow
+
+	p.Colors.Suggestion = term.AttrGrey
+
+	p.ModeNames.Insert = "(ins)"
+	p.ModeNames.Normal = "(cmd)"
+	p.Editor           = "vi"
+	p.Continuation = "> "
 
 	return p
 }
@@ -138,24 +241,22 @@ func (p *Prompt) cursorChar() rune {
 	if p.curx == len(*p.line) {
 		return 0
 	} else {
-		return rune((*p.line)[p.curx])
+		char, _ := utf8.DecodeRuneInString((*p.line)[p.curx:])
+
+		return char
 	}
 }
 
 func (p *Prompt) moveCursorLeft() {
-	if p.curx > 0 {
-		p.curx --
-	}
+	p.curx = prevChar(*p.line, p.curx)
 }
 
 func (p *Prompt) moveCursorRight() {
-	if p.curx < len(*p.line) {
-		p.curx ++
-	}
+	p.curx = nextChar(*p.line, p.curx)
 }
 
 func isWordChar(char rune) bool {
-	return unicode.IsLetter(char) || unicode.IsDigit(char) || char == '_'
+	return unicode.IsLetter(char) || unicode.IsDigit(char) || unicode.IsMark(char) || char == '_'
 }
 
 func (p *Prompt) moveCursorLeftByWord() {
@@ -201,13 +302,76 @@ func (p *Prompt) moveCursorRightByWord() {
 	}
 }
 
+// Length of the first word of a string, including the spaces before it
+func firstWordLen(str string) (length int) {
+	char, size := utf8.DecodeRuneInString(str)
+	for length < len(str) && unicode.IsSpace(char) {
+		length    += size
+		char, size = utf8.DecodeRuneInString(str[length:])
+	}
+
+	// A word is either made of word characters or of the other characters
+	isWord := isWordChar(char)
+	for length < len(str) && !unicode.IsSpace(char) && isWordChar(char) == isWord {
+		length    += size
+		char, size = utf8.DecodeRuneInString(str[length:])
+	}
+
+	return
+}
+
+func (p *Prompt) insertStringAtCursor(str string) {
+	for _, char := range str {
+		p.insertCharAtCursor(char)
+	}
+}
+
+// Is the cursor at the end of the whole input?
+func (p *Prompt) cursorAtEnd() bool {
+	return p.cury == len(p.lines) - 1 && p.curx == len(*p.line)
+}
+
+func (p *Prompt) setLine(y int) {
+	p.cury = y
+	p.line = &p.lines[y]
+}
+
+// Moves the cursor to another line, keeping the column if the line is long enough
+func (p *Prompt) moveCursorToLine(y int) {
+	width := textWidth((*p.line)[:p.curx])
+
+	p.setLine(y)
+	p.curx = idxAtWidth(*p.line, width)
+}
+
+// Splits the line at the cursor, the cursor goes to the start of the new line
+func (p *Prompt) splitLine() {
+	rest   := (*p.line)[p.curx:]
+	*p.line = (*p.line)[:p.curx]
+
+	p.lines = append(p.lines[:p.cury + 1], append([]string{rest}, p.lines[p.cury + 1:]...)...)
+	p.setLine(p.cury + 1)
+
+	p.curx = 0
+}
+
+// Joins the line with the previous one
+func (p *Prompt) joinLine() {
+	prev := p.lines[p.cury - 1]
+
+	p.lines[p.cury - 1] += *p.line
+	p.lines = append(p.lines[:p.cury], p.lines[p.cury + 1:]...)
+	p.setLine(p.cury - 1)
+
+	p.curx = len(prev)
+}
+
 func (p *Prompt) eraseCharAtCursor() {
 	if p.curx > 0 {
-		part1 := (*p.line)[:p.curx - 1]
-		part2 := (*p.line)[p.curx:]
+		start := prevChar(*p.line, p.curx)
 
-		*p.line = part1 + part2
-		p.curx  --
+		*p.line = (*p.line)[:start] + (*p.line)[p.curx:]
+		p.curx  = start
 	}
 }
 
@@ -217,11 +381,175 @@ func (p *Prompt) insertCharAtCursor(char rune) {
 	part2 := (*p.line)[p.curx:]
 
 	*p.line = part1 + string(char) + part2
-	p.curx  ++
+	p.curx += len(string(char))
+}
+
+func (p *Prompt) replaceWord(start int, word string) {
+	*p.line = (*p.line)[:start] + word + (*p.line)[p.curx:]
+	p.curx  = start + len(word)
+}
+
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, str := range strs[1:] {
+		for !strings.HasPrefix(str, prefix) {
+			prefix = prefix[:len(prefix) - 1]
+		}
+	}
+
+	// Do not split a multi-byte character
+	for i := 1; i < utf8.UTFMax && i <= len(prefix); i ++ {
+		if utf8.RuneStart(prefix[len(prefix) - i]) {
+			if !utf8.FullRuneInString(prefix[len(prefix) - i:]) {
+				prefix = prefix[:len(prefix) - i]
+			}
+
+			break
+		}
+	}
+
+	return prefix
+}
+
+func (p *Prompt) complete() {
+	if p.completer == nil {
+		return
+	}
+
+	// Cycle through the candidates in the menu
+	if len(p.menu) > 0 {
+		p.menuSel = (p.menuSel + 1) % len(p.menu)
+		p.replaceWord(p.menuStart, p.menu[p.menuSel])
+
+		return
+	}
+
+	candidates, start := p.completer.Complete(*p.line, p.curx)
+	switch len(candidates) {
+	case 0: return
+	case 1:
+		p.replaceWord(start, candidates[0])
+
+		// Directories are likely to be completed further
+		if !strings.HasSuffix(candidates[0], "/") {
+			p.insertCharAtCursor(' ')
+		}
+
+	default:
+		// Complete the common part, show the menu if there is none
+		if prefix := commonPrefix(candidates); len(prefix) > p.curx - start {
+			p.replaceWord(start, prefix)
+		} else {
+			p.menu      = candidates
+			p.menuSel   = -1
+			p.menuStart = start
+		}
+	}
+}
+
+// Moves the cursor to an index in the joined lines
+func (p *Prompt) setCursor(idx int) {
+	for y, line := range p.lines {
+		if idx <= len(line) {
+			p.setLine(y)
+			p.curx = idx
+
+			return
+		}
+
+		idx -= len(line) + 1
+	}
+}
+
+func (p *Prompt) startSearch(backward bool) {
+	p.History.ToEnd()
+
+	p.search = &historySearch{
+		idx:      len(p.History.list) - 1,
+		backward: backward,
+		original: strings.Join(p.lines, "\n"),
+	}
+}
+
+// Searches the history for the query, optionally skipping the current match
+func (p *Prompt) searchNext(skip bool) {
+	s := p.search
+
+	from := s.idx
+	if skip || from == len(p.History.list) - 1 {
+		if s.backward {
+			from --
+		} else {
+			from ++
+		}
+	}
+
+	idx := p.History.Find(s.query, from, s.backward)
+	if idx == -1 {
+		s.failed = true
+
+		return
+	}
+
+	s.idx    = idx
+	s.failed = false
+
+	p.History.idx = idx
+	p.SetInput(p.History.list[idx])
+
+	// Put the cursor on the match
+	if s.backward {
+		s.match = strings.LastIndex(p.History.list[idx], s.query)
+	} else {
+		s.match = strings.Index(p.History.list[idx], s.query)
+	}
+
+	p.setCursor(s.match)
+}
+
+// Handles a key during the search, returns false if the key ended the search and should be
+// handled normally
+func (p *Prompt) searchKey(key term.Key) bool {
+	s := p.search
+
+	switch {
+	case key == term.Ctrl(term.Key('r')), key == term.Ctrl(term.Key('s')):
+		s.backward = key == term.Ctrl(term.Key('r'))
+		p.searchNext(true)
+
+	case key == term.KeyBackspace:
+		if len(s.query) > 0 {
+			s.query = s.query[:prevChar(s.query, len(s.query))]
+		}
+
+		// Search again from the newest entry
+		s.idx = len(p.History.list) - 1
+		p.searchNext(false)
+
+	// Cancel the search
+	case key == term.Ctrl(term.Key('g')):
+		p.SetInput(s.original)
+		p.History.ToEnd()
+
+		p.search = nil
+
+	case key.Printable():
+		s.query += string(rune(key))
+		p.searchNext(false)
+
+	// Any other key accepts the match
+	default:
+		p.search = nil
+
+		return false
+	}
+
+	return true
 }
 
 func getLastPromptLine(prompt string) (lastLine string, lastLineLen int) {
-	skip := false
+	skip    := false
+	visible := ""
 	for _, ch := range prompt {
 		// Ignore characters marked to be ignored
 		switch ch {
@@ -240,26 +568,34 @@ func getLastPromptLine(prompt string) (lastLine string, lastLineLen int) {
 
 		if !skip {
 			if ch == '\n' {
-				lastLineLen = 0
-				lastLine    = ""
+				lastLine = ""
+				visible  = ""
 			} else {
-				lastLineLen ++
+				visible += string(ch)
 			}
 		}
 	}
 
+	lastLineLen = textWidth(visible)
+
 	return
 }
 
 func (p *Prompt) clear() {
 	p.lines = []string{""}
-	p.line  = &p.lines[0]
-	p.curx  = 0
+	p.setLine(0)
+
+	p.curx   = 0
+	p.menu   = nil
+	p.search = nil
+	p.undos  = nil
+	p.action = actionNone
+	p.vi     = viState{lastChange: p.vi.lastChange}
 
 	p.History.ToEnd()
 }
 
-func (p *Prompt) Input(prompt string) string {
+func (p *Prompt) setMode() {
 	var flags term.Flag
 	flags = term.CBreak | term.NoEcho
 
@@ -267,99 +603,196 @@ func (p *Prompt) Input(prompt string) string {
 		flags |= term.NoIxon
 	}
 
-	// Init the terminal
-	p.prevMode = term.SaveMode()
 	term.SetMode(flags)
 	term.InitGetKey()
+}
+
+func (p *Prompt) Input(prompt string) string {
+	// Init the terminal
+	p.prevMode = term.SaveMode()
+	p.setMode()
 	term.Update()
 
-	lastPromptLine, lastPromptLineLen := getLastPromptLine(prompt)
+	rawPrompt := prompt
+
+	lastPromptLine, lastPromptLineLen := getLastPromptLine(p.showMode(rawPrompt))
+	contPrompt,     contPromptLen     := getLastPromptLine(p.Continuation)
+
+	// Pad the continuation prompt so the following lines line up with the first one
+	if contPromptLen < lastPromptLineLen {
+		contPrompt    = strings.Repeat(" ", lastPromptLineLen - contPromptLen) + contPrompt
+		contPromptLen = lastPromptLineLen
+	}
+
+	// Length of the prompt before an input line
+	promptLen := func(y int) int {
+		if y == 0 {
+			return lastPromptLineLen
+		}
+
+		return contPromptLen
+	}
+
+	// Lines used by an input line with its prompt, a full last row is followed by a line for the
+	// cursor
+	linesUsed := func(y int, line string) int {
+		rows, col := cursorAfter(expandTabs(line, 0), promptLen(y), term.Width)
+		if col == term.Width {
+			rows ++
+		}
+
+		return rows + 1
+	}
 
 	// Remove the ignore marking characters
 	prompt = strings.Replace(prompt, "\x01", "", -1)
 	prompt = strings.Replace(prompt, "\x02", "", -1)
 
-	fmt.Print(prompt) // Output all lines of the prompt (this is for multiline prompts)
+	fmt.Print(p.showMode(prompt)) // Output all lines of the prompt (this is for multiline prompts)
 
-	hasPossibleErrMsg    := false // Is there a possible error msg displayed?
-	possibleErrLinesUsed := 1     // The number of lines a possible error was rendered over
-	inputLinesUsed       := 1
-	clearAll             := false
+	hasMsgBelow    := false // Is there a possible error msg or a completion menu displayed?
+	msgLinesUsed   := 1     // The number of lines the message was rendered over
+	inputLinesUsed := 1
+	clearAll       := false
 
 	// Hide the cursor for rendering
 	term.HideCursor()
 
-	typing := true
+	typing      := true
+	interrupted := false
+	suggestion  := "" // Shown after the cursor in the last iteration
+	offy        := 0  // Line of the cursor, relative to the first input line
 	for typing {
 		var possibleErr      error
 		var highlightedInput string
 
+		input := strings.Join(p.lines, "\n")
+
+		// The mode shown in the prompt might have changed
+		lastPromptLine, lastPromptLineLen = getLastPromptLine(p.showMode(rawPrompt))
+
 		// Highlight the input and show possible errors
 		if p.Flags.Interactive && p.highlighter != nil {
 			if p.Flags.ShowPossibleErrors || p.Flags.SyntaxHighlighting {
-				highlightedInput, possibleErr = p.highlighter.Highlight(*p.line, "stdin")
+				highlightedInput, possibleErr = p.highlighter.Highlight(input, "stdin")
 
 				if !p.Flags.ShowPossibleErrors {
 					possibleErr = nil
 				}
 
 				if !p.Flags.SyntaxHighlighting {
-					highlightedInput = *p.line
+					highlightedInput = input
 				}
 			}
 		}
 
-		// Clear the previous input
-		if clearAll {
+		// Mark the match of the history search instead
+		if s := p.search; s != nil && !s.failed && len(s.query) > 0 {
+			if s.idx < len(p.History.list) - 1 {
+				highlightedInput = input[:s.match] + p.Colors.Match + s.query + term.AttrReset +
+				                   input[s.match + len(s.query):]
+			}
+		}
+
+		highlightedLines := strings.Split(highlightedInput, "\n")
+
+		// Suggest the rest of a history entry when typing at the end of the input
+		suggestion = ""
+		if p.Flags.Interactive && p.search == nil && len(p.menu) == 0 && len(input) > 0 &&
+		   p.cursorAtEnd() {
+			suggestion = p.History.Suggest(input)
+		}
+
+		// Clear the previous input, editing one of multiple lines can change all the lines after it
+		if clearAll || len(p.lines) > 1 {
 			term.ClearLines(inputLinesUsed)
 		} else {
 			term.NewLines(inputLinesUsed - 1)
 			term.ClearCursorLine()
 		}
 
-		// Clear previous error msgs
-		if hasPossibleErrMsg {
+		// Clear previous error msgs and menus
+		if hasMsgBelow {
 			term.NewLine()
-			term.ClearLines(possibleErrLinesUsed)
-			term.MoveCursorUp(possibleErrLinesUsed)
+			term.ClearLines(msgLinesUsed)
+			term.MoveCursorUp(msgLinesUsed)
 		}
 
 		term.MoveCursorUp(inputLinesUsed - 1)
 
-		// Output the last line of the prompt and the input
-		fmt.Print(lastPromptLine, highlightedInput)
+		// Output the last line of the prompt and the input, the following input lines are preceded
+		// by the continuation prompt
+		inputLinesUsed = 0
+		for y, line := range p.lines {
+			if y == 0 {
+				fmt.Print(lastPromptLine)
+			} else {
+				term.NewLine()
+				fmt.Print(term.AttrReset + contPrompt)
+			}
+
+			if y < len(highlightedLines) {
+				fmt.Print(expandTabs(highlightedLines[y], 0))
+			}
 
-		// Create a new line for the cursor if only the cursor gets put on a new line
-		if (lastPromptLineLen + len(*p.line)) % term.Width == 0 {
-			term.NewLine()
-			term.ClearCursorLine()
+			// The suggestion is shown after the last line
+			shown := line
+			if y == len(p.lines) - 1 && len(suggestion) > 0 {
+				fmt.Print(p.Colors.Suggestion + expandTabs(suggestion, textWidth(line)) +
+				          term.AttrReset)
+
+				shown += suggestion
+			}
+
+			// Create a new line for the cursor if only the cursor gets put on a new line
+			if _, col := cursorAfter(expandTabs(shown, 0), promptLen(y), term.Width);
+			   col == term.Width {
+				term.NewLine()
+				term.ClearCursorLine()
+			}
+
+			// Lines used by the prompt and input
+			inputLinesUsed += linesUsed(y, shown)
 		}
 
-		// Lines used by the prompt and input
-		inputLinesUsed = (len(*p.line) + lastPromptLineLen) / term.Width + 1
+		// Render the search prompt, the completion menu or possible errors if there are any
+		if p.search != nil {
+			msgLinesUsed = p.renderSearch()
 
-		// Render possible errors if there are any
-		if possibleErr != nil {
-			possibleErrLinesUsed = p.renderPossibleError(possibleErr)
+			hasMsgBelow = true
+		} else if len(p.menu) > 0 {
+			msgLinesUsed = p.renderMenu()
 
-			hasPossibleErrMsg = true
+			hasMsgBelow = true
+		} else if possibleErr != nil {
+			msgLinesUsed = p.renderPossibleError(possibleErr)
+
+			hasMsgBelow = true
 		} else {
-			hasPossibleErrMsg = false
+			hasMsgBelow = false
 		}
 
 		// Position the cursor
 		term.MoveCursorUp(inputLinesUsed - 1)
 		term.MoveCursorToLineStart()
 
-		offx := lastPromptLineLen + p.curx
-		offy := 0
-		if offx >= term.Width {
-			offy = offx / term.Width
-			offx = offx % term.Width
+		// Skip the lines above the cursor
+		offy = 0
+		for y := 0; y < p.cury; y ++ {
+			offy += linesUsed(y, p.lines[y])
+		}
+
+		rows, offx := cursorAfter(expandTabs((*p.line)[:p.curx], 0), promptLen(p.cury), term.Width)
 
-			term.NewLines(offy)
+		// A wide character which does not fit on the row goes to the next one with the cursor
+		if offx == term.Width || offx + charWidth((*p.line)[p.curx:]) > term.Width {
+			rows ++
+			offx = 0
 		}
 
+		offy += rows
+
+		term.NewLines(offy)
 		term.MoveCursorRight(offx)
 
 		clearAll = false
@@ -369,54 +802,243 @@ func (p *Prompt) Input(prompt string) string {
 		// Read input
 		key := term.GetKey(true)
 
+		// Any other key closes the completion menu
+		if key != term.KeyTab {
+			p.menu = nil
+		}
+
+		// Keys bound by the user
+		var boundCmd string
+		if p.search == nil {
+			key, boundCmd = p.boundKey(key)
+		}
+
+		before := p.snapshot()
+
+		p.prevAction = p.action
+		p.action     = actionNone
+
+		// Keys which do not belong to the history search end it and are handled normally
+		if p.search != nil && key != term.KeyResize && p.searchKey(key) {
+			key = term.KeyNone
+		}
+
+		if p.Flags.Vi && key != term.KeyNone {
+			key = p.viKey(key)
+		}
+
 		switch key {
-		case term.KeyEnter: typing = false
+		case term.KeyEnter:
+			// Incomplete input continues on a new line
+			if p.NeedsMore != nil && p.NeedsMore(input) {
+				clearAll = true
+				p.splitLine()
+			} else {
+				typing = false
+			}
 
-		case term.KeyBackspace: p.eraseCharAtCursor()
+		case term.KeyBackspace:
+			if p.curx == 0 && p.cury > 0 {
+				clearAll = true
+				p.joinLine()
+			} else {
+				p.eraseCharAtCursor()
+			}
 
+		case term.KeyDelete:
+			clearAll = true
+
+			p.deleteCharAtCursor()
+
+		case term.KeyTab: p.complete()
+
+		// Move between the lines, or through the history on the first and last line
 		case term.KeyArrowUp:
 			clearAll = true
-			p.SetInput(p.History.Up())
+
+			if p.cury > 0 {
+				p.moveCursorToLine(p.cury - 1)
+			} else {
+				p.History.Start(input)
+				p.SetInput(p.History.Up())
+			}
 
 		case term.KeyArrowDown:
 			clearAll = true
-			p.SetInput(p.History.Down())
 
-		case term.KeyArrowRight: p.moveCursorRight()
-		case term.KeyArrowLeft:  p.moveCursorLeft()
+			if p.cury < len(p.lines) - 1 {
+				p.moveCursorToLine(p.cury + 1)
+			} else {
+				p.History.Start(input)
+				p.SetInput(p.History.Down())
+			}
+
+		case term.KeyArrowRight:
+			if len(suggestion) > 0 {
+				p.insertStringAtCursor(suggestion)
+			} else if p.curx == len(*p.line) && p.cury < len(p.lines) - 1 {
+				p.setLine(p.cury + 1)
+				p.curx = 0
+			} else {
+				p.moveCursorRight()
+			}
+
+		case term.KeyArrowLeft:
+			if p.curx == 0 && p.cury > 0 {
+				p.setLine(p.cury - 1)
+				p.curx = len(*p.line)
+			} else {
+				p.moveCursorLeft()
+			}
 
-		case term.KeyCtrlArrowRight: p.moveCursorRightByWord()
+		case term.KeyCtrlArrowRight:
+			if len(suggestion) > 0 {
+				p.insertStringAtCursor(suggestion[:firstWordLen(suggestion)])
+			} else {
+				p.moveCursorRightByWord()
+			}
+
+		case term.KeyHome, term.Ctrl(term.Key('a')): p.curx = 0
+		case term.KeyEnd,  term.Ctrl(term.Key('e')):
+			if len(suggestion) > 0 {
+				p.insertStringAtCursor(suggestion)
+			} else {
+				p.curx = len(*p.line)
+			}
 		case term.KeyCtrlArrowLeft:  p.moveCursorLeftByWord()
 
-		case term.Ctrl(term.Key('s')):
+		case term.Alt(term.Key('b')): p.moveCursorLeftByWord()
+		case term.Alt(term.Key('f')): p.moveCursorRightByWord()
+
+		// Killing and yanking text
+		case term.Ctrl(term.Key('k')): p.killToLineEnd()
+		case term.Ctrl(term.Key('u')): p.killToLineStart()
+		case term.Ctrl(term.Key('w')): p.killPrevWord()
+		case term.Alt(term.Key('d')):  p.killNextWord()
+		case term.Ctrl(term.Key('y')): p.yank()
+		case term.Alt(term.Key('y')):  p.yankPop()
+
+		case term.Ctrl(term.Key('t')): p.transpose()
+		case term.Ctrl(term.Key('_')): p.undo()
+
+		// Clear the screen and render the prompt at the top
+		case term.Ctrl(term.Key('l')):
+			term.ClearScreen()
+			fmt.Print(p.showMode(prompt))
+
+			offy           = 0
+			inputLinesUsed = 1
+			hasMsgBelow    = false
+
+		case keyInsertLastArg: p.insertLastArg()
+
+		// Run the command below the input, the prompt is rendered again after its output
+		case keyRunCmd:
+			term.MoveCursorUp(offy)
+			term.NewLines(inputLinesUsed)
+			term.ClearToScreenEnd()
+
+			if p.RunCmd != nil {
+				term.RestoreMode(p.prevMode)
+				term.ShowCursor()
+				p.RunCmd(boundCmd)
+				p.setMode()
+			}
+
+			fmt.Print(p.showMode(prompt))
+
+			offy           = 0
+			inputLinesUsed = 1
+			hasMsgBelow    = false
+
+		// Edit the input in the editor, which gets the whole terminal
+		case keyEditor:
+			term.MoveCursorUp(offy)
+			term.MoveCursorToLineStart()
+			term.ClearToScreenEnd()
+
+			if err := p.editInEditor(); err == nil {
+				p.vi.normal = true
+			}
+
+			offy           = 0
+			inputLinesUsed = 1
+			hasMsgBelow    = false
+
+		// Incremental history search
+		case term.Ctrl(term.Key('r')), term.Ctrl(term.Key('s')):
+			p.startSearch(key == term.Ctrl(term.Key('r')))
 
 		case term.KeyResize:
 			clearAll = true
 
 			term.Update()
 
+		// Drop the input
+		case term.KeyInterrupt:
+			typing      = false
+			interrupted = true
+
 		default:
-			if key >= term.Key(' ') && key <= term.Key('~') {
+			if key.Printable() {
 				p.insertCharAtCursor(rune(key))
+
+				p.action = actionInsert
 			}
 		}
 
+		if p.Flags.Vi && p.vi.normal {
+			p.viClamp()
+		}
+
+		if p.action != actionUndo {
+			p.saveUndo(before)
+		}
+
+		// Shorter input or the suggestion might leave parts of the old one on the screen
+		if len(strings.Join(p.lines, "\n")) < len(input) || len(suggestion) > 0 {
+			clearAll = true
+		}
+
 		term.HideCursor()
 		term.MoveCursorUp(offy)
 	}
 
-	term.NewLines(inputLinesUsed - 1)
+	// The suggestion is not a part of the input, clear it with the messages below the input
+	if len(suggestion) > 0 {
+		term.MoveCursorDown(offy)
+		term.ClearToScreenEnd()
+		term.MoveCursorUp(offy)
 
-	ret := ""
-	for i, line := range p.lines {
-		if i > 0 {
-			ret += "; "
+		hasMsgBelow    = false
+		inputLinesUsed = 0
+		for y, line := range p.lines {
+			inputLinesUsed += linesUsed(y, line)
 		}
+	}
 
-		ret += line
+	// Clear the message below the input so the output does not mix with it
+	if hasMsgBelow {
+		term.NewLines(inputLinesUsed)
+		term.ClearLines(msgLinesUsed)
+		term.MoveCursorUp(msgLinesUsed - 1 + inputLinesUsed)
 	}
 
-	p.History.Add(ret)
+	ret := ""
+	if interrupted {
+		// Mark the input as dropped
+		last := len(p.lines) - 1
+
+		term.NewLines(inputLinesUsed - 1)
+		term.MoveCursorToLineStart()
+		_, col := cursorAfter(expandTabs(p.lines[last], 0), promptLen(last), term.Width)
+		term.MoveCursorRight(col % term.Width)
+		fmt.Print("^C")
+	} else {
+		term.NewLines(inputLinesUsed - 1)
+
+		ret = strings.Join(p.lines, "\n")
+	}
 
 	fmt.Println()
 	term.RestoreMode(p.prevMode)
@@ -427,13 +1049,99 @@ func (p *Prompt) Input(prompt string) string {
 	return ret
 }
 
+// Only the last part of paths is shown in the menu
+func menuItem(candidate string) string {
+	if i := strings.LastIndex(strings.TrimSuffix(candidate, "/"), "/"); i != -1 {
+		return candidate[i + 1:]
+	}
+
+	return candidate
+}
+
+const menuMaxRows = 10
+
+func (p *Prompt) renderMenu() (linesUsed int) {
+	// Fit as many columns as possible
+	width := 0
+	for _, candidate := range p.menu {
+		if textWidth(menuItem(candidate)) + 2 > width {
+			width = textWidth(menuItem(candidate)) + 2
+		}
+	}
+
+	if width > term.Width {
+		width = term.Width
+	}
+
+	cols := term.Width / width
+	rows := (len(p.menu) + cols - 1) / cols
+
+	// Scroll the rows so the selected candidate is visible
+	firstRow := 0
+	if p.menuSel / cols >= menuMaxRows {
+		firstRow = p.menuSel / cols - menuMaxRows + 1
+	}
+
+	for row := firstRow; row < rows && row < firstRow + menuMaxRows; row ++ {
+		term.NewLine()
+		linesUsed ++
+
+		for col := 0; col < cols && row * cols + col < len(p.menu); col ++ {
+			i    := row * cols + col
+			item := menuItem(p.menu[i])
+			if textWidth(item) > width - 1 {
+				item = item[:idxAtWidth(item, width - 1)]
+			}
+
+			if i == p.menuSel {
+				fmt.Print("\x1b[7m" + item + term.AttrReset)
+			} else {
+				fmt.Print(item)
+			}
+
+			fmt.Print(strings.Repeat(" ", width - textWidth(item)))
+		}
+	}
+
+	if rows > menuMaxRows {
+		term.NewLine()
+		linesUsed ++
+
+		fmt.Printf("%v%v candidates%v", p.Colors.Error, len(p.menu), term.AttrReset)
+	}
+
+	term.MoveCursorUp(linesUsed)
+
+	return
+}
+
+func (p *Prompt) renderSearch() int {
+	term.NewLine()
+
+	label := "i-search"
+	if p.search.backward {
+		label = "reverse-i-search"
+	}
+
+	if p.search.failed {
+		label = "failed " + label
+	}
+
+	fmt.Printf("(%v)`%v'", label, p.search.query)
+
+	term.MoveCursorUp(1)
+
+	return 1
+}
+
 func (p *Prompt) renderPossibleError(err error) (linesUsed int) {
 	term.NewLine()
 
 	msg := "Error: " + err.Error()
 	fmt.Print(p.Colors.Error + msg + term.AttrReset)
 
-	linesUsed = int(math.Ceil(float64(len(msg)) / float64(term.Width)))
+	rows, _  := cursorAfter(msg, 0, term.Width)
+	linesUsed = rows + 1
 
 	term.MoveCursorUp(linesUsed)
 
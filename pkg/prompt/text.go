@@ -0,0 +1,210 @@
+package prompt
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The cursor moves by the characters seen by the user, one of them can be made of multiple runes,
+// like a letter with combining marks or an emoji sequence
+
+// Runes which belong to the character before them
+func isExtending(r rune) bool {
+	return unicode.In(r, unicode.Mn, unicode.Me, unicode.Mc) ||
+	       (r >= 0xfe00 && r <= 0xfe0f) ||  // Variation selectors
+	       (r >= 0x1f3fb && r <= 0x1f3ff)    // Skin tone modifiers
+}
+
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
+
+// Returns the index after the character at idx
+func nextChar(str string, idx int) int {
+	if idx >= len(str) {
+		return len(str)
+	}
+
+	r, size := utf8.DecodeRuneInString(str[idx:])
+	idx += size
+
+	// Flags are made of two regional indicators
+	if isRegionalIndicator(r) && idx < len(str) {
+		if next, size := utf8.DecodeRuneInString(str[idx:]); isRegionalIndicator(next) {
+			idx += size
+		}
+	}
+
+	for idx < len(str) {
+		next, size := utf8.DecodeRuneInString(str[idx:])
+		if next == '\u200d' {
+			// Zero width joiner joins the rune after it too
+			idx += size
+			if idx < len(str) {
+				_, size = utf8.DecodeRuneInString(str[idx:])
+				idx    += size
+			}
+		} else if isExtending(next) {
+			idx += size
+		} else {
+			break
+		}
+	}
+
+	return idx
+}
+
+// Returns the index of the character before idx
+func prevChar(str string, idx int) int {
+	// Characters can not be reliably found going backwards, so walk from the start
+	prev := 0
+	for i := 0; i < idx; i = nextChar(str, i) {
+		prev = i
+	}
+
+	return prev
+}
+
+const tabWidth = 8
+
+// Characters taking two cells of the terminal
+var wide = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x1100, 0x115f, 1}, {0x231a, 0x231b, 1}, {0x2329, 0x232a, 1}, {0x23e9, 0x23ec, 1},
+		{0x23f0, 0x23f0, 1}, {0x23f3, 0x23f3, 1}, {0x25fd, 0x25fe, 1}, {0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1}, {0x267f, 0x267f, 1}, {0x2693, 0x2693, 1}, {0x26a1, 0x26a1, 1},
+		{0x26aa, 0x26ab, 1}, {0x26bd, 0x26be, 1}, {0x26c4, 0x26c5, 1}, {0x26ce, 0x26ce, 1},
+		{0x26d4, 0x26d4, 1}, {0x26ea, 0x26ea, 1}, {0x26f2, 0x26f3, 1}, {0x26f5, 0x26f5, 1},
+		{0x26fa, 0x26fa, 1}, {0x26fd, 0x26fd, 1}, {0x2705, 0x2705, 1}, {0x270a, 0x270b, 1},
+		{0x2728, 0x2728, 1}, {0x274c, 0x274c, 1}, {0x274e, 0x274e, 1}, {0x2753, 0x2755, 1},
+		{0x2757, 0x2757, 1}, {0x2795, 0x2797, 1}, {0x27b0, 0x27b0, 1}, {0x27bf, 0x27bf, 1},
+		{0x2b1b, 0x2b1c, 1}, {0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1}, {0x2e80, 0x303e, 1},
+		{0x3041, 0x33ff, 1}, {0x3400, 0x4dbf, 1}, {0x4e00, 0x9fff, 1}, {0xa000, 0xa4cf, 1},
+		{0xa960, 0xa97f, 1}, {0xac00, 0xd7a3, 1}, {0xf900, 0xfaff, 1}, {0xfe10, 0xfe19, 1},
+		{0xfe30, 0xfe6f, 1}, {0xff00, 0xff60, 1}, {0xffe0, 0xffe6, 1},
+	},
+	R32: []unicode.Range32{
+		{0x16fe0, 0x16fe4, 1}, {0x17000, 0x18cff, 1}, {0x1b000, 0x1b2ff, 1}, {0x1f004, 0x1f004, 1},
+		{0x1f0cf, 0x1f0cf, 1}, {0x1f18e, 0x1f18e, 1}, {0x1f191, 0x1f19a, 1}, {0x1f1e6, 0x1f1ff, 1},
+		{0x1f200, 0x1f2ff, 1}, {0x1f300, 0x1f64f, 1}, {0x1f680, 0x1f6ff, 1}, {0x1f7e0, 0x1f7eb, 1},
+		{0x1f900, 0x1f9ff, 1}, {0x1fa70, 0x1faff, 1}, {0x20000, 0x2fffd, 1}, {0x30000, 0x3fffd, 1},
+	},
+}
+
+// Width of the character at the start of the string
+func charWidth(char string) int {
+	r, _ := utf8.DecodeRuneInString(char)
+	switch {
+	case unicode.Is(wide, r): return 2
+
+	// Emoji presentation selector makes the character an emoji
+	case strings.ContainsRune(char, 0xfe0f): return 2
+
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf, unicode.Cc),
+	     r >= 0x1160 && r <= 0x11ff: // Hangul vowels and final consonants join the syllable
+		return 0
+
+	default: return 1
+	}
+}
+
+// Returns the index and the column after the character at idx, tabs go to the next tab stop
+func advance(str string, idx, col int) (int, int) {
+	next := nextChar(str, idx)
+	if str[idx] == '\t' {
+		return next, col + tabWidth - col % tabWidth
+	}
+
+	return next, col + charWidth(str[idx:next])
+}
+
+// Width of a string on the screen, tabs are expanded from the start of the string
+func textWidth(str string) (width int) {
+	for i := 0; i < len(str); {
+		i, width = advance(str, i, width)
+	}
+
+	return
+}
+
+// Index in a string up to which the text fits into the width
+func idxAtWidth(str string, width int) int {
+	i, col := 0, 0
+	for i < len(str) {
+		next, nextCol := advance(str, i, col)
+		if nextCol > width {
+			break
+		}
+
+		i, col = next, nextCol
+	}
+
+	return i
+}
+
+// Replaces the tabs with spaces up to the next tab stop, the string is shown from the column col
+// and the escape sequences in it take no space
+func expandTabs(str string, col int) string {
+	if !strings.Contains(str, "\t") {
+		return str
+	}
+
+	var expanded strings.Builder
+	for i := 0; i < len(str); {
+		next := i
+
+		switch str[i] {
+		case '\x1b':
+			// Skip to the final byte of the sequence
+			next = i + 1
+			if next < len(str) && str[next] == '[' {
+				next ++
+				for next < len(str) && (str[next] < 0x40 || str[next] > 0x7e) {
+					next ++
+				}
+
+				next ++
+			}
+
+			if next > len(str) {
+				next = len(str)
+			}
+
+		case '\t':
+			prev := col
+			i, col = advance(str, i, col)
+
+			expanded.WriteString(strings.Repeat(" ", col - prev))
+
+			continue
+
+		default: next, col = advance(str, i, col)
+		}
+
+		expanded.WriteString(str[i:next])
+		i = next
+	}
+
+	return expanded.String()
+}
+
+// Row and column of the cursor after printing a string from the column col of a terminal of the
+// width, wide characters which do not fit at the end of a row are moved to the next one. The
+// column is the width if the last row is full
+func cursorAfter(str string, col, width int) (y, x int) {
+	y, x = col / width, col % width
+	for i := 0; i < len(str); {
+		next := nextChar(str, i)
+		if w := charWidth(str[i:next]); x + w > width {
+			y ++
+			x = w
+		} else {
+			x += w
+		}
+
+		i = next
+	}
+
+	return
+}
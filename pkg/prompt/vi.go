@@ -0,0 +1,443 @@
+package prompt
+
+import (
+	"os"
+	"os/exec"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/LordOfTrident/snash/pkg/term"
+)
+
+// Marks the place in the prompt where the editing mode is shown
+const modeMarker = "\x03"
+
+type viState struct {
+	normal bool // Normal mode, otherwise insert mode
+
+	count   int      // Count typed before the command, 0 if none
+	op      term.Key // Pending operator (d, c or y), 0 if none
+	opCount int      // Count typed before the operator
+
+	keys       []term.Key // Keys of the command being typed, recorded for repeating
+	inserting  bool       // Recording the text inserted by a change command
+	lastChange []term.Key // Repeated with '.'
+	replaying  bool
+}
+
+func (p *Prompt) modeName() string {
+	if !p.Flags.Vi {
+		return ""
+	} else if p.vi.normal {
+		return p.ModeNames.Normal
+	}
+
+	return p.ModeNames.Insert
+}
+
+func (p *Prompt) showMode(prompt string) string {
+	return strings.Replace(prompt, modeMarker, p.modeName(), -1)
+}
+
+// Handles a key in the vi mode, returns the key which should still be handled like in the emacs
+// mode or term.KeyNone
+func (p *Prompt) viKey(key term.Key) term.Key {
+	if !p.vi.normal {
+		// Alt sends an escape before the key, which might come together with a quickly typed key
+		if key & term.Alt(0) != 0 {
+			p.viInsertKey(term.KeyEscape)
+
+			return p.viKey(key &^ term.Alt(0))
+		}
+
+		if p.viInsertKey(key) {
+			return term.KeyNone
+		}
+
+		return key
+	}
+
+	switch key {
+	case term.Key('j'), term.Key('k'):
+		p.viReset()
+
+		if key == term.Key('j') {
+			return term.KeyArrowDown
+		}
+
+		return term.KeyArrowUp
+
+	case term.Key('v'):
+		p.viReset()
+
+		return keyEditor
+	}
+
+	// Control keys work like in the insert mode
+	if !key.Printable() {
+		p.viReset()
+
+		return key
+	}
+
+	p.viNormalKey(key)
+
+	return term.KeyNone
+}
+
+// Handles the keys of the insert mode which need to be known by the vi mode, returns true if the
+// key was handled
+func (p *Prompt) viInsertKey(key term.Key) bool {
+	if p.vi.inserting && !p.vi.replaying {
+		p.vi.keys = append(p.vi.keys, key)
+	}
+
+	switch {
+	case key == term.KeyEscape:
+		p.vi.normal = true
+		p.moveCursorLeft()
+
+		if p.vi.inserting {
+			p.vi.inserting = false
+			if !p.vi.replaying {
+				p.vi.lastChange = p.vi.keys
+			}
+		}
+
+		p.vi.keys = nil
+
+		return true
+
+	// The keys are handled here when repeating a change, otherwise in the input loop
+	case !p.vi.replaying: return false
+
+	case key == term.KeyBackspace: p.eraseCharAtCursor()
+
+	case key.Printable(): p.insertCharAtCursor(rune(key))
+	}
+
+	return true
+}
+
+func (p *Prompt) viReset() {
+	p.vi.count, p.vi.op, p.vi.opCount = 0, 0, 0
+	p.vi.keys = nil
+}
+
+// Enters the insert mode, the text inserted is a part of the change
+func (p *Prompt) viInsert() {
+	p.vi.normal    = false
+	p.vi.inserting = true
+}
+
+// Called when a command is finished, changes are recorded so they can be repeated
+func (p *Prompt) viDone(change bool) {
+	p.vi.count, p.vi.op, p.vi.opCount = 0, 0, 0
+
+	if p.vi.replaying {
+		return
+	}
+
+	if !change {
+		p.vi.keys = nil
+	} else if !p.vi.inserting {
+		p.vi.lastChange = p.vi.keys
+		p.vi.keys       = nil
+	}
+}
+
+func (p *Prompt) viNormalKey(key term.Key) {
+	if !p.vi.replaying {
+		p.vi.keys = append(p.vi.keys, key)
+	}
+
+	// Counts
+	if (key >= term.Key('1') && key <= term.Key('9')) || (key == term.Key('0') && p.vi.count > 0) {
+		p.vi.count = p.vi.count * 10 + int(key - term.Key('0'))
+
+		return
+	}
+
+	count := 1
+	if p.vi.count > 0 {
+		count = p.vi.count
+	}
+
+	if p.vi.op != 0 {
+		if p.vi.opCount > 0 {
+			count *= p.vi.opCount
+		}
+
+		p.viOperator(p.vi.op, key, count)
+
+		return
+	}
+
+	switch key {
+	case term.Key('h'), term.Key('l'), term.Key('w'), term.Key('b'), term.Key('e'),
+	     term.Key('0'), term.Key('$'), term.Key('^'):
+		p.curx = p.viMotion(key, count)
+		p.viDone(false)
+
+	case term.Key('d'), term.Key('c'), term.Key('y'):
+		p.vi.op      = key
+		p.vi.opCount = p.vi.count
+		p.vi.count   = 0
+
+	case term.Key('x'):
+		end := p.curx
+		for i := 0; i < count; i ++ {
+			end = nextChar(*p.line, end)
+		}
+
+		p.kill(p.curx, end)
+		p.viDone(true)
+
+	case term.Key('D'), term.Key('C'):
+		p.killToLineEnd()
+		if key == term.Key('C') {
+			p.viInsert()
+
+			p.action = actionInsert // Undo the change together with the inserted text
+		}
+
+		p.viDone(true)
+
+	case term.Key('p'), term.Key('P'):
+		if len(p.killRing) > 0 {
+			if key == term.Key('p') {
+				p.moveCursorRight()
+			}
+
+			p.insertStringAtCursor(strings.Repeat(p.killRing[len(p.killRing) - 1], count))
+			p.moveCursorLeft()
+		}
+
+		p.viDone(true)
+
+	case term.Key('i'), term.Key('a'), term.Key('I'), term.Key('A'):
+		switch key {
+		case term.Key('a'): p.moveCursorRight()
+		case term.Key('I'): p.curx = 0
+		case term.Key('A'): p.curx = len(*p.line)
+		}
+
+		p.viInsert()
+		p.viDone(true)
+
+	case term.Key('u'):
+		for i := 0; i < count; i ++ {
+			p.undo()
+		}
+
+		p.viDone(false)
+
+	case term.Key('.'):
+		p.viDone(false)
+		p.viRepeat(count)
+
+	default: p.viReset()
+	}
+}
+
+// Applies an operator to the text between the cursor and the motion, the operator typed twice
+// applies to the whole line
+func (p *Prompt) viOperator(op, key term.Key, count int) {
+	start, end := p.curx, 0
+	switch key {
+	case op: start, end = 0, len(*p.line)
+
+	// Changing a word keeps the spaces after it, like changing to the end of the word
+	case term.Key('w'):
+		if op == term.Key('c') && !unicode.IsSpace(p.cursorChar()) {
+			end = nextChar(*p.line, p.viMotion(term.Key('e'), count))
+		} else {
+			end = p.viMotion(key, count)
+		}
+
+	case term.Key('e'): end = nextChar(*p.line, p.viMotion(key, count))
+
+	case term.Key('h'), term.Key('l'), term.Key('b'),
+	     term.Key('0'), term.Key('$'), term.Key('^'):
+		end = p.viMotion(key, count)
+
+	default:
+		p.viReset()
+
+		return
+	}
+
+	if start > end {
+		start, end = end, start
+	}
+
+	if end > len(*p.line) {
+		end = len(*p.line)
+	}
+
+	switch op {
+	case term.Key('d'): p.kill(start, end)
+	case term.Key('c'):
+		p.kill(start, end)
+		p.viInsert()
+
+		p.action = actionInsert // Undo the change together with the inserted text
+
+	case term.Key('y'):
+		p.killRing = append(p.killRing, (*p.line)[start:end])
+		if len(p.killRing) > killRingSize {
+			p.killRing = p.killRing[1:]
+		}
+	}
+
+	p.viDone(op != term.Key('y'))
+}
+
+// Words are either made of word characters or of the other non-space characters, the class is 0
+// for spaces, 1 for word characters and 2 for the others
+func charClass(str string, idx int) int {
+	char, _ := utf8.DecodeRuneInString(str[idx:])
+
+	switch {
+	case unicode.IsSpace(char): return 0
+	case isWordChar(char):      return 1
+
+	default: return 2
+	}
+}
+
+// Returns the cursor position after a motion
+func (p *Prompt) viMotion(key term.Key, count int) int {
+	line := *p.line
+	x    := p.curx
+
+	// Index of the last character
+	last := prevChar(line, len(line))
+
+	for i := 0; i < count; i ++ {
+		switch key {
+		case term.Key('h'): x = prevChar(line, x)
+		case term.Key('l'): x = nextChar(line, x)
+
+		// Start of the next word
+		case term.Key('w'):
+			if x < len(line) {
+				class := charClass(line, x)
+				for x < len(line) && charClass(line, x) == class {
+					x = nextChar(line, x)
+				}
+			}
+
+			for x < len(line) && charClass(line, x) == 0 {
+				x = nextChar(line, x)
+			}
+
+		// Start of the previous word
+		case term.Key('b'):
+			for x > 0 && charClass(line, prevChar(line, x)) == 0 {
+				x = prevChar(line, x)
+			}
+
+			if x > 0 {
+				class := charClass(line, prevChar(line, x))
+				for x > 0 && charClass(line, prevChar(line, x)) == class {
+					x = prevChar(line, x)
+				}
+			}
+
+		// End of the word
+		case term.Key('e'):
+			if x < last {
+				x = nextChar(line, x)
+			}
+
+			for x < last && charClass(line, x) == 0 {
+				x = nextChar(line, x)
+			}
+
+			if x < len(line) {
+				class := charClass(line, x)
+				for x < last && charClass(line, nextChar(line, x)) == class {
+					x = nextChar(line, x)
+				}
+			}
+
+		case term.Key('0'): return 0
+		case term.Key('$'): return len(line)
+		case term.Key('^'):
+			x = 0
+			for x < len(line) && charClass(line, x) == 0 {
+				x = nextChar(line, x)
+			}
+
+			return x
+		}
+	}
+
+	return x
+}
+
+func (p *Prompt) viRepeat(count int) {
+	p.vi.replaying = true
+	defer func() {
+		p.vi.replaying = false
+	}()
+
+	for i := 0; i < count; i ++ {
+		for _, key := range p.vi.lastChange {
+			if p.vi.normal {
+				p.viNormalKey(key)
+			} else {
+				p.viInsertKey(key)
+			}
+		}
+	}
+}
+
+// The cursor can not be after the last character in the normal mode
+func (p *Prompt) viClamp() {
+	if p.curx > 0 && p.curx >= len(*p.line) {
+		p.curx = prevChar(*p.line, len(*p.line))
+	}
+}
+
+// Edits the input in the editor, the terminal is given to it for the time of editing
+func (p *Prompt) editInEditor() error {
+	f, err := os.CreateTemp("", "snash-*.snash")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(strings.Join(p.lines, "\n") + "\n")
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	args := strings.Fields(p.Editor)
+	if len(args) == 0 {
+		args = []string{"vi"}
+	}
+
+	cmd := exec.Command(args[0], append(args[1:], f.Name())...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	term.RestoreMode(p.prevMode)
+	err = cmd.Run()
+	p.setMode()
+
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+
+	p.SetInput(strings.TrimSuffix(string(data), "\n"))
+
+	return nil
+}
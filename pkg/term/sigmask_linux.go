@@ -0,0 +1,26 @@
+//go:build linux
+
+package term
+
+import (
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// Blocks SIGTTOU for the calling thread, the returned function restores the signal mask
+func blockTTOU() (restore func()) {
+	// The signal mask is per thread
+	runtime.LockOSThread()
+
+	var set, old unix.Sigset_t
+	set.Val[0] = 1 << (unix.SIGTTOU - 1)
+
+	unix.PthreadSigmask(unix.SIG_BLOCK, &set, &old)
+
+	return func() {
+		unix.PthreadSigmask(unix.SIG_SETMASK, &old, nil)
+
+		runtime.UnlockOSThread()
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+
+package term
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+var ttou = make(chan os.Signal, 1)
+
+// Signals can not be blocked for a single thread here, so SIGTTOU is ignored by the process
+// instead. The returned function catches it again, so the shell still does not get stopped
+func blockTTOU() (restore func()) {
+	signal.Ignore(syscall.SIGTTOU)
+
+	return func() {
+		signal.Notify(ttou, syscall.SIGTTOU)
+	}
+}
@@ -10,6 +10,10 @@ import (
 	"strconv"
 	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/sys/unix"
 )
 
 const (
@@ -45,8 +49,8 @@ var (
 
 type Key int
 const (
-	// Additional keys
-	KeyArrowUp = Key(iota + 256)
+	// Additional keys, above all the unicode characters
+	KeyArrowUp = Key(iota + keySpecial)
 	KeyArrowDown
 	KeyArrowLeft
 	KeyArrowRight
@@ -56,7 +60,12 @@ const (
 	KeyCtrlArrowLeft
 	KeyCtrlArrowRight
 
-	KeyResize // Window resize event
+	KeyHome
+	KeyEnd
+	KeyDelete
+
+	KeyResize    // Window resize event
+	KeyInterrupt // Ctrl+C was pressed
 
 	// ASCII keys
 	KeyEnter     = Key('\n')
@@ -65,6 +74,11 @@ const (
 	KeyTab       = Key('\t')
 
 	KeyNone = 0
+
+	keySpecial = 1 << 21
+	KeyCustom  = Key(keySpecial + 1 << 12) // Base for keys defined by the users of the package
+
+	altMask = Key(1 << 22) // Set on keys pressed with Alt
 )
 
 type Flag int
@@ -87,6 +101,77 @@ func Ctrl(key Key) Key {
 	}
 }
 
+func Alt(key Key) Key {
+	return key | altMask
+}
+
+// Keys which insert a character
+func (key Key) Printable() bool {
+	return key >= Key(' ') && key < keySpecial && unicode.IsPrint(rune(key))
+}
+
+var keyNames = map[string]Key{
+	"up":    KeyArrowUp,
+	"down":  KeyArrowDown,
+	"left":  KeyArrowLeft,
+	"right": KeyArrowRight,
+
+	"ctrl-up":    KeyCtrlArrowUp,
+	"ctrl-down":  KeyCtrlArrowDown,
+	"ctrl-left":  KeyCtrlArrowLeft,
+	"ctrl-right": KeyCtrlArrowRight,
+
+	"home":   KeyHome,
+	"end":    KeyEnd,
+	"delete": KeyDelete,
+
+	"enter":     KeyEnter,
+	"backspace": KeyBackspace,
+	"escape":    KeyEscape,
+	"tab":       KeyTab,
+	"space":     Key(' '),
+}
+
+// Parses key names like 'ctrl-g', 'alt-.', 'home' or 'x'
+func ParseKey(name string) (Key, bool) {
+	if key, ok := keyNames[strings.ToLower(name)]; ok {
+		return key, true
+	}
+
+	switch {
+	case utf8.RuneCountInString(name) == 1:
+		if key := Key([]rune(name)[0]); key.Printable() && key != Key(' ') {
+			return key, true
+		}
+
+	case strings.HasPrefix(strings.ToLower(name), "ctrl-") && len(name) == 6:
+		return Ctrl(Key(name[5])), true
+
+	case strings.HasPrefix(strings.ToLower(name), "alt-"):
+		if key, ok := ParseKey(name[4:]); ok && key & altMask == 0 {
+			return Alt(key), true
+		}
+	}
+
+	return KeyNone, false
+}
+
+func (key Key) String() string {
+	for name, named := range keyNames {
+		if key == named {
+			return name
+		}
+	}
+
+	switch {
+	case key & altMask != 0: return "alt-" + (key &^ altMask).String()
+	case key < Key(' '):     return "ctrl-" + strings.ToLower(string(rune(key + Key('@'))))
+	case key.Printable():    return string(rune(key))
+
+	default: return fmt.Sprintf("key-%v", int(key))
+	}
+}
+
 func SaveMode() string {
 	// Save the previous terminal attributes
 	bytes, err := exec.Command("stty", "-F", "/dev/tty", "-g").Output()
@@ -114,7 +199,57 @@ func OnCtrlC(callback func()) {
 	}()
 }
 
-var resizedEvent = false
+func OnQuit(callback func()) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGQUIT)
+
+	go func() {
+		for {
+			<- c
+			callback()
+		}
+	}()
+}
+
+var tty *os.File
+
+func OpenTTY() (*os.File, error) {
+	if tty != nil {
+		return tty, nil
+	}
+
+	var err error
+	tty, err = os.OpenFile("/dev/tty", os.O_RDWR, 0)
+
+	return tty, err
+}
+
+// Puts a process group into the foreground of the terminal. SIGTTOU is blocked for the time of
+// the call, because a process in the background changing the foreground would get stopped
+func SetForeground(tty *os.File, pgid int) error {
+	defer blockTTOU()()
+
+	return unix.IoctlSetPointerInt(int(tty.Fd()), unix.TIOCSPGRP, pgid)
+}
+
+var (
+	resizedEvent     = false
+	interruptedEvent = false
+)
+
+// Makes GetKey return KeyInterrupt and Interrupted return true
+func Interrupt() {
+	interruptedEvent = true
+}
+
+// Was there an interrupt since the last ClearInterrupt?
+func Interrupted() bool {
+	return interruptedEvent
+}
+
+func ClearInterrupt() {
+	interruptedEvent = false
+}
 
 func SendResizeEvents() {
 	c := make(chan os.Signal, 1)
@@ -249,6 +384,14 @@ func NewLines(count int) {
 	}
 }
 
+func ClearScreen() {
+	fmt.Print("\x1b[H\x1b[2J")
+}
+
+func ClearToScreenEnd() {
+	fmt.Print("\x1b[J")
+}
+
 func ClearLines(count int) {
 	for i := 0; i < count; i ++ {
 		if i > 0 {
@@ -259,19 +402,35 @@ func ClearLines(count int) {
 	}
 }
 
+// Characters left from the previous read, when more than one came at once
+var pending []byte
+
 func GetKey(blocking bool) (key Key) {
 	// Array big enough to catch escape sequences that we need
 	in := make([]byte, 8)
+	n  := 0
+
+	if len(pending) > 0 && pending[0] == 27 {
+		// An escape sequence came right after the previous character
+		n       = copy(in, pending)
+		pending = nil
+	} else if utf8.FullRune(pending) {
+		return nextPending()
+	}
 
 	// I hope this infinite loop waiting for a keypress/event wont cause any issues
-	for {
-		os.Stdin.Read(in)
+	for n == 0 {
+		n, _ = os.Stdin.Read(in)
 
 		if in[0] == 0 {
 			if resizedEvent {
 				resizedEvent = false
 
 				return KeyResize
+			} else if interruptedEvent {
+				interruptedEvent = false
+
+				return KeyInterrupt
 			} else if !blocking {
 				return KeyNone
 			}
@@ -279,6 +438,7 @@ func GetKey(blocking bool) (key Key) {
 			break
 		}
 
+		n = 0
 		time.Sleep(20 * time.Millisecond)
 	}
 
@@ -294,14 +454,33 @@ func GetKey(blocking bool) (key Key) {
 			length ++
 		}
 
+		// Alt with a multi-byte character
+		if length > 1 && in[1] >= utf8.RuneSelf {
+			r, _ := utf8.DecodeRune(in[1:length])
+
+			return Alt(Key(r))
+		}
+
 		switch length {
 		case 1: key = KeyEscape // Just the escape key
-		case 3: // Arrow keys sequence
+		case 2: key = Alt(Key(in[1])) // Alt sends an escape before the key
+		case 3: // Arrow keys, home and end sequence
 			switch in[2] {
 			case 'A': key = KeyArrowUp
 			case 'B': key = KeyArrowDown
 			case 'C': key = KeyArrowRight
 			case 'D': key = KeyArrowLeft
+			case 'H': key = KeyHome
+			case 'F': key = KeyEnd
+			}
+
+		case 4: // Home, end and delete sequence
+			if in[1] == '[' && in[3] == '~' {
+				switch in[2] {
+				case '1', '7': key = KeyHome
+				case '4', '8': key = KeyEnd
+				case '3':      key = KeyDelete
+				}
 			}
 
 		case 6: // CTRL + arrow keys sequence
@@ -315,8 +494,27 @@ func GetKey(blocking bool) (key Key) {
 			}
 		}
 
-	default: key = Key(in[0]) // Otherwise, return the first character
+	default: // Otherwise, return the first character
+		pending = append(pending, in[:n]...)
+
+		// A multi-byte character might be split between reads
+		for tries := 0; !utf8.FullRune(pending) && tries < 10; tries ++ {
+			if n, _ = os.Stdin.Read(in); n == 0 {
+				time.Sleep(5 * time.Millisecond)
+			}
+
+			pending = append(pending, in[:n]...)
+		}
+
+		key = nextPending()
 	}
 
 	return
 }
+
+func nextPending() Key {
+	r, size := utf8.DecodeRune(pending)
+	pending   = pending[size:]
+
+	return Key(r)
+}